@@ -3,7 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/thewh1teagle/sona/internal/audio"
@@ -23,16 +26,16 @@ func newRootCommand() *cobra.Command {
 		Version: version,
 	}
 	rootCmd.PersistentFlags().BoolVarP(&a.verbose, "verbose", "v", false, "show ffmpeg and whisper/ggml logs")
-	rootCmd.AddCommand(a.newTranscribeCommand(), a.newServeCommand(), newPullCommand(), newDevicesCommand())
+	rootCmd.AddCommand(a.newTranscribeCommand(), a.newDetectLanguageCommand(), a.newServeCommand(), newPullCommand(), newDevicesCommand())
 	return rootCmd
 }
 
 func (a *app) newTranscribeCommand() *cobra.Command {
-	var language, prompt string
+	var language, prompt, vadModel, grammarFile, grammarRule string
 	var translate, detectLanguage bool
-	var enhanceAudio, wordTimestamps bool
+	var enhanceAudio, wordTimestamps, vad bool
 	var threads, maxTextCtx, maxSegmentLen, bestOf, beamSize, gpuDevice int
-	var temperature float32
+	var temperature, grammarPenalty float32
 
 	cmd := &cobra.Command{
 		Use:   "transcribe <model.bin> <audio.wav>",
@@ -44,12 +47,26 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 			audio.SetVerbose(a.verbose)
 			whisper.SetVerbose(a.verbose)
 
-			samples, err := audio.ReadFileWithOptions(audioPath, audio.ReadOptions{
-				EnhanceAudio: enhanceAudio,
-			})
+			var grammar string
+			if grammarFile != "" {
+				data, err := os.ReadFile(grammarFile)
+				if err != nil {
+					return fmt.Errorf("error reading grammar: %w", err)
+				}
+				grammar = string(data)
+				if _, err := whisper.ParseGrammar(grammar, grammarRule); err != nil {
+					return fmt.Errorf("invalid grammar %s: %w", grammarFile, err)
+				}
+			}
+
+			samples, err := audio.ReadFile(audioPath)
 			if err != nil {
 				return fmt.Errorf("error reading audio: %w", err)
 			}
+			var cuts audio.Cuts
+			if enhanceAudio {
+				samples, cuts = audio.RemoveSilence(samples)
+			}
 
 			ctx, err := whisper.New(modelPath, gpuDevice, false)
 			if err != nil {
@@ -70,10 +87,18 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 				MaxSegmentLen:  maxSegmentLen,
 				BestOf:         bestOf,
 				BeamSize:       beamSize,
+				VAD:            vad || vadModel != "",
+				VADModelPath:   vadModel,
+				Grammar:        grammar,
+				GrammarRule:    grammarRule,
+				GrammarPenalty: grammarPenalty,
 			})
 			if err != nil {
 				return fmt.Errorf("error transcribing: %w", err)
 			}
+			if len(cuts) > 0 {
+				result = result.MapTimes(cuts.OriginalTime)
+			}
 			fmt.Println(result.Text())
 			return nil
 		},
@@ -81,7 +106,7 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 
 	cmd.Flags().StringVarP(&language, "language", "l", "", "language code (e.g. en, he); empty uses whisper.cpp default (en)")
 	cmd.Flags().BoolVar(&detectLanguage, "detect-language", false, "auto-detect language")
-	cmd.Flags().BoolVar(&enhanceAudio, "enhance-audio", false, "clean audio with ffmpeg before transcription (slower, can reduce repeats)")
+	cmd.Flags().BoolVar(&enhanceAudio, "enhance-audio", false, "remove long silences before transcription (can reduce repeats; timestamps stay on the original timeline)")
 	cmd.Flags().BoolVar(&translate, "translate", false, "translate to English")
 	cmd.Flags().IntVar(&threads, "threads", 0, "CPU threads (0 = default)")
 	cmd.Flags().StringVar(&prompt, "prompt", "", "initial prompt / vocabulary hint")
@@ -91,13 +116,72 @@ func (a *app) newTranscribeCommand() *cobra.Command {
 	cmd.Flags().IntVar(&maxSegmentLen, "max-segment-len", 0, "max segment length in characters (0 = no limit)")
 	cmd.Flags().IntVar(&bestOf, "best-of", 0, "greedy sampling: top candidates (0 = default)")
 	cmd.Flags().IntVar(&beamSize, "beam-size", 0, "beam search: beam width (0 = default)")
+	cmd.Flags().BoolVar(&vad, "vad", false, "transcribe only speech found by voice activity detection (timestamps stay on the original timeline)")
+	cmd.Flags().StringVar(&vadModel, "vad-model", "", "Silero ggml model for --vad (implies --vad; default: built-in energy detector)")
+	cmd.Flags().StringVar(&grammarFile, "grammar-file", "", "GBNF grammar file that constrains the transcript")
+	cmd.Flags().StringVar(&grammarRule, "grammar-rule", whisper.DefaultGrammarRule, "start rule of --grammar-file")
+	cmd.Flags().Float32Var(&grammarPenalty, "grammar-penalty", 0, "penalty for tokens outside the grammar (0 = default, 100)")
+	cmd.Flags().IntVar(&gpuDevice, "gpu-device", -1, "GPU device index (-1 = whisper default)")
+	return cmd
+}
+
+func (a *app) newDetectLanguageCommand() *cobra.Command {
+	var topK, threads, gpuDevice int
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "detect-language <model.bin> <audio.wav>",
+		Short: "Identify the spoken language of an audio file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			modelPath := args[0]
+			audioPath := args[1]
+			// Same bounds as POST /v1/audio/language.
+			if topK < 1 {
+				return fmt.Errorf("--top-k must be at least 1")
+			}
+			if maxDuration := time.Duration(whisper.LanguageDetectWindow) * time.Second / whisper.SampleRate; duration <= 0 || duration > maxDuration {
+				return fmt.Errorf("--duration must be more than 0 and at most %v", maxDuration)
+			}
+			audio.SetVerbose(a.verbose)
+			whisper.SetVerbose(a.verbose)
+
+			samples, err := audio.ReadFileWithOptions(audioPath, audio.ReadOptions{})
+			if err != nil {
+				return fmt.Errorf("error reading audio: %w", err)
+			}
+			samples = samples[:min(len(samples), int(duration.Seconds()*whisper.SampleRate))]
+
+			ctx, err := whisper.New(modelPath, gpuDevice, false)
+			if err != nil {
+				return fmt.Errorf("error loading model: %w", err)
+			}
+			defer ctx.Close()
+
+			langs, err := ctx.DetectLanguage(samples, threads)
+			if err != nil {
+				return fmt.Errorf("error detecting language: %w", err)
+			}
+			for _, l := range langs[:min(len(langs), topK)] {
+				fmt.Printf("%s\t%s\t%.4f\n", l.Code, l.Name, l.Probability)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&topK, "top-k", "k", 5, "number of languages to print, most likely first")
+	cmd.Flags().DurationVar(&duration, "duration", 30*time.Second, "analyze this much audio from the start (at most 30s)")
+	cmd.Flags().IntVar(&threads, "threads", 0, "CPU threads (0 = default)")
 	cmd.Flags().IntVar(&gpuDevice, "gpu-device", -1, "GPU device index (-1 = whisper default)")
 	return cmd
 }
 
 func (a *app) newServeCommand() *cobra.Command {
-	var host string
-	var port int
+	var host, socket, apiKeysFile, modelsDir, cacheDir, vadModel string
+	var port, queueSize, concurrency, threadsPerJob, parentPID, cacheSizeMB int
+	var exitOnStdinClose bool
+	var apiKeys, allowDirs []string
+	var maxAudioDuration, ffmpegTimeout, keepAlive, drainTimeout time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "serve [model.bin]",
@@ -107,23 +191,111 @@ func (a *app) newServeCommand() *cobra.Command {
 			audio.SetVerbose(a.verbose)
 			whisper.SetVerbose(a.verbose)
 
+			if socket != "" && (cmd.Flags().Changed("host") || cmd.Flags().Changed("port")) {
+				return fmt.Errorf("--socket cannot be combined with --host or --port")
+			}
+
 			s := server.New(a.verbose)
+			// Started before the model loads so an owner that dies meanwhile
+			// is still noticed; Stop before serving shuts down right away.
+			if parentPID > 0 {
+				go watchParent(parentPID, s.Stop)
+			}
+			if exitOnStdinClose {
+				go watchStdin(s.Stop)
+			}
+			audio.SetConvertHook(s.ObserveConversion)
 			s.Version = version
 			s.Commit = commit
+			s.QueueDepth = queueSize
+			s.Concurrency = concurrency
+			s.ThreadsPerJob = threadsPerJob
+			s.KeepAlive = keepAlive
+			s.DrainTimeout = drainTimeout
+			if vadModel != "" {
+				if info, err := os.Stat(vadModel); err != nil || info.IsDir() {
+					return fmt.Errorf("VAD model not found: %s", vadModel)
+				}
+				s.VADModelPath = vadModel
+			}
+			s.FFmpegSandbox.MaxDuration = maxAudioDuration
+			s.FFmpegSandbox.Timeout = ffmpegTimeout
+			if modelsDir != "" {
+				if info, err := os.Stat(modelsDir); err != nil || !info.IsDir() {
+					return fmt.Errorf("models directory not found: %s", modelsDir)
+				}
+				s.ModelsDir = modelsDir
+			}
+			for _, dir := range allowDirs {
+				if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+					return fmt.Errorf("allowed directory not found: %s", dir)
+				}
+			}
+			s.AllowedDirs = allowDirs
+			// Without configured directories, client paths are limited to the
+			// directory of the startup model.
+			if len(allowDirs) == 0 && modelsDir == "" {
+				if len(args) > 0 {
+					s.AllowedDirs = []string{filepath.Dir(args[0])}
+				} else {
+					log.Printf("warning: model and diarizer paths from clients are not restricted; use --allow-dir or --models-dir")
+				}
+			}
+			if cacheDir != "" {
+				if err := s.EnableCache(cacheDir, int64(cacheSizeMB)<<20); err != nil {
+					return fmt.Errorf("error opening cache: %w", err)
+				}
+			}
+
+			// API keys from --api-key, SONA_API_KEY and --api-keys-file are combined.
+			s.APIKeys = apiKeys
+			if envKey := os.Getenv("SONA_API_KEY"); envKey != "" {
+				s.APIKeys = append(s.APIKeys, envKey)
+			}
+			if apiKeysFile != "" {
+				keys, err := server.ReadAPIKeys(apiKeysFile)
+				if err != nil {
+					return fmt.Errorf("error reading API keys: %w", err)
+				}
+				if len(keys) == 0 {
+					return fmt.Errorf("no API keys in %s", apiKeysFile)
+				}
+				s.APIKeys = append(s.APIKeys, keys...)
+			}
 
 			// Load initial model if provided.
 			if len(args) > 0 {
-				if err := s.LoadModel(args[0], -1, false); err != nil {
+				if _, err := s.LoadModel("", args[0], -1, false); err != nil {
 					return fmt.Errorf("error loading model: %w", err)
 				}
 			}
 
+			if socket != "" {
+				return server.ListenAndServeUnix(socket, s)
+			}
 			return server.ListenAndServe(host, port, s)
 		},
 	}
 
 	cmd.Flags().StringVar(&host, "host", "127.0.0.1", "host to bind to")
 	cmd.Flags().IntVarP(&port, "port", "p", 0, "port to listen on (0 = auto-assign)")
+	cmd.Flags().StringVar(&socket, "socket", "", "listen on this Unix domain socket instead of TCP")
+	cmd.Flags().IntVar(&queueSize, "queue-size", 8, "max transcriptions waiting while all workers are busy (0 = reject when busy)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 1, "transcriptions to run at once on the same loaded model")
+	cmd.Flags().IntVar(&threadsPerJob, "threads-per-job", 0, "max CPU threads per transcription (0 = CPUs divided by --concurrency)")
+	cmd.Flags().DurationVar(&keepAlive, "keep-alive", 0, "unload models after this long without requests and reload on demand (0 = keep loaded)")
+	cmd.Flags().DurationVar(&drainTimeout, "drain-timeout", 30*time.Second, "on shutdown, let in-flight transcriptions finish for this long before aborting them")
+	cmd.Flags().DurationVar(&maxAudioDuration, "max-audio-duration", audio.DefaultSandbox.MaxDuration, "reject uploads longer than this (0 = unlimited)")
+	cmd.Flags().DurationVar(&ffmpegTimeout, "ffmpeg-timeout", audio.DefaultSandbox.Timeout, "kill ffmpeg conversions of uploads after this long (0 = no timeout)")
+	cmd.Flags().StringVar(&modelsDir, "models-dir", "", "directory of .bin models that can be listed and loaded by id")
+	cmd.Flags().StringArrayVar(&allowDirs, "allow-dir", nil, "only accept model and diarizer paths from clients inside this directory (repeatable; --models-dir is always allowed; default: the startup model's directory)")
+	cmd.Flags().StringVar(&vadModel, "vad-model", "", "Silero ggml model used for requests with vad=true (default: built-in energy detector)")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "cache transcription results in this directory and reuse them for identical requests")
+	cmd.Flags().IntVar(&cacheSizeMB, "cache-size", 1024, "max size of --cache-dir in MB; least recently used results are evicted")
+	cmd.Flags().StringArrayVar(&apiKeys, "api-key", nil, "require this bearer token on all endpoints except /health (repeatable; also SONA_API_KEY)")
+	cmd.Flags().IntVar(&parentPID, "parent-pid", 0, "shut down gracefully when the process with this pid exits")
+	cmd.Flags().BoolVar(&exitOnStdinClose, "exit-on-stdin-close", false, "shut down gracefully when stdin is closed")
+	cmd.Flags().StringVar(&apiKeysFile, "api-keys-file", "", "file with accepted API keys, one per line")
 	return cmd
 }
 
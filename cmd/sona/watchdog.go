@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// parentPollInterval is how often --parent-pid checks the owner process.
+const parentPollInterval = time.Second
+
+// watchParent calls onExit once the process pid has exited. If pid was our
+// parent at startup, being re-parented also counts as exited, which guards
+// against the pid being reused by an unrelated process.
+func watchParent(pid int, onExit func()) {
+	wasParent := os.Getppid() == pid
+	for {
+		if (wasParent && os.Getppid() != pid) || !processAlive(pid) {
+			log.Printf("parent process %d exited, shutting down", pid)
+			onExit()
+			return
+		}
+		time.Sleep(parentPollInterval)
+	}
+}
+
+// watchStdin calls onExit once stdin is closed, e.g. because the process
+// holding the other end of the pipe exited. Input is discarded.
+func watchStdin(onExit func()) {
+	io.Copy(io.Discard, os.Stdin)
+	log.Println("stdin closed, shutting down")
+	onExit()
+}
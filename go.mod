@@ -3,11 +3,14 @@ module github.com/thewh1teagle/sona
 go 1.25.2
 
 require (
-	github.com/danielgtaylor/huma/v2 v2.35.0 // indirect
+	github.com/danielgtaylor/huma/v2 v2.35.0
+	github.com/spf13/cobra v1.10.2
+	golang.org/x/net v0.40.0
+	golang.org/x/sys v0.41.0
+)
+
+require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/cobra v1.10.2 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
-	golang.org/x/net v0.40.0 // indirect
-	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/text v0.25.0 // indirect
 )
@@ -2,25 +2,97 @@ package audio
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/thewh1teagle/sona/internal/wav"
 )
 
 var verbose bool
 
+// ErrTooLong is returned when sandboxed input exceeds the duration or
+// output size limit.
+var ErrTooLong = errors.New("audio exceeds the maximum allowed length")
+
+// allowedDemuxers are the ffmpeg demuxers a Sandbox accepts: common audio
+// and video containers, but nothing that references other files or URLs
+// (playlists, concat lists, image sequences).
+var allowedDemuxers = []string{
+	"wav", "w64", "mp3", "flac", "ogg", "mov", "matroska", "aac", "asf",
+	"aiff", "avi", "flv", "amr", "caf", "au", "mpeg", "mpegts",
+}
+
+// Sandbox restricts ffmpeg when converting untrusted input: only local files
+// are readable, only allowedDemuxers are probed, and the run is bounded.
+type Sandbox struct {
+	MaxDuration   time.Duration // longest accepted input (0 = unlimited)
+	MaxOutputSize int64         // largest converted WAV in bytes (0 = derived from MaxDuration)
+	Timeout       time.Duration // ffmpeg is killed after this long (0 = no timeout)
+}
+
+// DefaultSandbox is the sandbox used for uploads to the server.
+var DefaultSandbox = Sandbox{
+	MaxDuration: 4 * time.Hour,
+	Timeout:     10 * time.Minute,
+}
+
+// bytesPerSecond is the data rate of a native 16kHz mono 16-bit WAV.
+const bytesPerSecond = 16000 * 2
+
+// wavHeaderSlack bounds the size of the WAV header ffmpeg writes, which
+// includes metadata chunks.
+const wavHeaderSlack = 4096
+
+// maxBytes is the size of a converted WAV holding MaxDuration of audio.
+func (sb *Sandbox) maxBytes() int64 {
+	return int64(sb.MaxDuration.Seconds()*bytesPerSecond) + wavHeaderSlack
+}
+
+// outputLimit returns the -fs limit in bytes, or 0 for none.
+func (sb *Sandbox) outputLimit() int64 {
+	if sb.MaxOutputSize > 0 || sb.MaxDuration <= 0 {
+		return sb.MaxOutputSize
+	}
+	// Leave room for the extra second -t lets through (see ConvertToNativeWavWithOptions).
+	return sb.maxBytes() + 2*bytesPerSecond
+}
+
+// exceeded reports whether a converted WAV of size bytes hit a limit.
+func (sb *Sandbox) exceeded(size int64) bool {
+	return (sb.MaxOutputSize > 0 && size >= sb.MaxOutputSize) ||
+		(sb.MaxDuration > 0 && size > sb.maxBytes())
+}
+
+// ConvertOptions controls ConvertToNativeWavWithOptions.
+type ConvertOptions struct {
+	Sandbox *Sandbox // nil = trusted input, no restrictions
+}
+
+// convertHook, if set, is called after every ffmpeg conversion.
+var convertHook func(elapsed time.Duration, err error)
+
 type ReadOptions struct {
-	EnhanceAudio bool
+	Sandbox *Sandbox // nil = trusted input, no restrictions
 }
 
 func SetVerbose(v bool) {
 	verbose = v
 }
 
+// SetConvertHook registers fn to be called with the duration and result of
+// every ffmpeg conversion. It must be set before any audio is read.
+func SetConvertHook(fn func(elapsed time.Duration, err error)) {
+	convertHook = fn
+}
+
 // findFFmpeg checks for ffmpeg in this order:
 // 1. System ffmpeg from $PATH
 // 2. SONA_FFMPEG_PATH env var (warns and continues if set but not found)
@@ -54,20 +126,38 @@ func findFFmpeg() (string, error) {
 }
 
 // ConvertToNativeWav converts any audio file to a 16kHz mono 16-bit PCM WAV file
-// on disk using ffmpeg. When enhanceAudio is true, a silence removal filter is applied.
-func ConvertToNativeWav(inputPath, outputPath string, enhanceAudio bool) error {
+// on disk using ffmpeg. Silence is removed separately, see RemoveSilence.
+func ConvertToNativeWav(inputPath, outputPath string) error {
+	return ConvertToNativeWavWithOptions(inputPath, outputPath, ConvertOptions{})
+}
+
+func ConvertToNativeWavWithOptions(inputPath, outputPath string, opts ConvertOptions) error {
 	ffmpegPath, err := findFFmpeg()
 	if err != nil {
 		return err
 	}
 
-	args := []string{
+	sb := opts.Sandbox
+	args := []string{"-nostdin"}
+	if sb != nil {
+		args = append(args,
+			"-protocol_whitelist", "file",
+			"-format_whitelist", strings.Join(allowedDemuxers, ","),
+		)
+		inputPath = "file:" + inputPath // never interpret the name as a protocol
+	}
+	args = append(args,
 		"-i", inputPath,
 		"-ar", "16000",
 		"-ac", "1",
+	)
+	if sb != nil && sb.MaxDuration > 0 {
+		// Convert one second more than allowed so that too long input can be
+		// told apart from input of exactly the maximum length.
+		args = append(args, "-t", strconv.FormatFloat((sb.MaxDuration+time.Second).Seconds(), 'f', -1, 64))
 	}
-	if enhanceAudio {
-		args = append(args, "-af", "silenceremove=stop_periods=-1:stop_duration=0.7:stop_threshold=-45dB")
+	if sb != nil && sb.outputLimit() > 0 {
+		args = append(args, "-fs", strconv.FormatInt(sb.outputLimit(), 10))
 	}
 	args = append(args,
 		"-acodec", "pcm_s16le",
@@ -75,7 +165,13 @@ func ConvertToNativeWav(inputPath, outputPath string, enhanceAudio bool) error {
 		outputPath,
 	)
 
-	cmd := exec.Command(ffmpegPath, args...)
+	ctx := context.Background()
+	if sb != nil && sb.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sb.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, ffmpegPath, args...)
 	var stderrBuf bytes.Buffer
 	if verbose {
 		cmd.Stderr = io.MultiWriter(os.Stderr, &stderrBuf)
@@ -83,7 +179,15 @@ func ConvertToNativeWav(inputPath, outputPath string, enhanceAudio bool) error {
 		cmd.Stderr = &stderrBuf
 	}
 
-	if err := cmd.Run(); err != nil {
+	start := time.Now()
+	err = cmd.Run()
+	if convertHook != nil {
+		convertHook(time.Since(start), err)
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("ffmpeg WAV conversion timed out after %s", sb.Timeout)
+	}
+	if err != nil {
 		stderr := stderrBuf.String()
 		if stderr != "" {
 			// Truncate stderr to avoid huge error messages
@@ -94,6 +198,13 @@ func ConvertToNativeWav(inputPath, outputPath string, enhanceAudio bool) error {
 		}
 		return fmt.Errorf("ffmpeg WAV conversion failed: %w", err)
 	}
+	if sb != nil {
+		// -t and -fs truncate silently; reaching either limit means the input
+		// was too long.
+		if info, statErr := os.Stat(outputPath); statErr == nil && sb.exceeded(info.Size()) {
+			return ErrTooLong
+		}
+	}
 	return nil
 }
 
@@ -106,11 +217,16 @@ func Read(r io.ReadSeeker) ([]float32, error) {
 
 func ReadWithOptions(r io.ReadSeeker, opts ReadOptions) ([]float32, error) {
 	h, err := wav.ReadHeader(r)
-	if err == nil && h.IsNative() && !opts.EnhanceAudio {
-		return wav.Read(r)
+	if err == nil && h.IsNative() {
+		samples, err := wav.Read(r)
+		if err == nil && opts.Sandbox != nil && opts.Sandbox.MaxDuration > 0 &&
+			len(samples) > int(opts.Sandbox.MaxDuration.Seconds()*16000) {
+			return nil, ErrTooLong
+		}
+		return samples, err
 	}
 
-	// Not a native WAV (or enhancement requested) — need ffmpeg
+	// Not a native WAV — need ffmpeg
 	r.Seek(0, io.SeekStart)
 
 	// Save to temp file for ffmpeg input
@@ -128,7 +244,9 @@ func ReadWithOptions(r io.ReadSeeker, opts ReadOptions) ([]float32, error) {
 
 	// Convert to native WAV via ffmpeg
 	nativeWav := tmp.Name() + ".wav"
-	if err := ConvertToNativeWav(tmp.Name(), nativeWav, opts.EnhanceAudio); err != nil {
+	if err := ConvertToNativeWavWithOptions(tmp.Name(), nativeWav, ConvertOptions{
+		Sandbox: opts.Sandbox,
+	}); err != nil {
 		return nil, err
 	}
 	defer os.Remove(nativeWav)
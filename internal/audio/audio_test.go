@@ -0,0 +1,113 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// nativeWav returns a 16kHz mono 16-bit PCM WAV of silence.
+func nativeWav(seconds int) []byte {
+	dataSize := uint32(seconds * bytesPerSecond)
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, 36+dataSize)
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(16000), uint32(bytesPerSecond), uint16(2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, dataSize)
+	b.Write(make([]byte, dataSize))
+	return b.Bytes()
+}
+
+func TestReadNativeWavMaxDuration(t *testing.T) {
+	sb := &Sandbox{MaxDuration: 2 * time.Second}
+	if _, err := ReadWithOptions(bytes.NewReader(nativeWav(2)), ReadOptions{Sandbox: sb}); err != nil {
+		t.Fatalf("2s input: %v", err)
+	}
+	if _, err := ReadWithOptions(bytes.NewReader(nativeWav(3)), ReadOptions{Sandbox: sb}); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("3s input: err = %v, want ErrTooLong", err)
+	}
+	if _, err := ReadWithOptions(bytes.NewReader(nativeWav(3)), ReadOptions{}); err != nil {
+		t.Fatalf("no sandbox: %v", err)
+	}
+}
+
+func TestSandboxExceeded(t *testing.T) {
+	sb := &Sandbox{MaxDuration: 10 * time.Second}
+	header := int64(78)
+	if sb.exceeded(header + 10*bytesPerSecond) {
+		t.Error("input of exactly the maximum length should be accepted")
+	}
+	if !sb.exceeded(header + 11*bytesPerSecond) {
+		t.Error("input one second too long should be rejected")
+	}
+	if limit := sb.outputLimit(); limit < header+11*bytesPerSecond {
+		t.Errorf("-fs limit %d would cut off the extra second", limit)
+	}
+
+	sb = &Sandbox{MaxOutputSize: 1000}
+	if !sb.exceeded(1000) || sb.exceeded(999) {
+		t.Error("MaxOutputSize not applied")
+	}
+}
+
+func TestRemoveSilence(t *testing.T) {
+	const sr = 16000
+	loud := func(n int) []float32 {
+		out := make([]float32, n)
+		for i := range out {
+			out[i] = 0.5
+			if i%2 == 1 {
+				out[i] = -0.5
+			}
+		}
+		return out
+	}
+	var samples []float32
+	samples = append(samples, loud(sr)...)
+	samples = append(samples, make([]float32, sr/2)...) // short pause, kept
+	samples = append(samples, loud(sr)...)
+	samples = append(samples, make([]float32, 2*sr)...) // removed
+	samples = append(samples, loud(sr)...)
+	samples = append(samples, make([]float32, sr)...) // trailing, removed
+
+	out, cuts := RemoveSilence(samples)
+	want := Cuts{
+		{2.5*sr + silenceKeep, 4.5*sr - silenceKeep},
+		{5.5*sr + silenceKeep, 6.5*sr - silenceKeep},
+	}
+	if len(cuts) != len(want) || cuts[0] != want[0] || cuts[1] != want[1] {
+		t.Fatalf("cuts = %v, want %v", cuts, want)
+	}
+	removed := 0
+	for _, c := range cuts {
+		removed += c.End - c.Start
+	}
+	if len(out) != len(samples)-removed {
+		t.Fatalf("got %d samples, want %d", len(out), len(samples)-removed)
+	}
+
+	// The third loud second starts at 4.5s in the original.
+	start, wantStart := int(2.5*sr)+2*silenceKeep, int(4.5*sr)
+	if got := cuts.Original(start, false); got != wantStart {
+		t.Errorf("Original(%d) = %d, want %d", start, got, wantStart)
+	}
+	if got := cuts.Original(2.5*sr+silenceKeep, true); got != 2.5*sr+silenceKeep {
+		t.Errorf("end on a cut maps to %d, want the start of the cut", got)
+	}
+	if got := cuts.OriginalTime(100, false); got != 100 {
+		t.Errorf("OriginalTime(100) = %d, want 100 (before any cut)", got)
+	}
+	if got := cuts.OriginalTime(280, false); got != 460 {
+		t.Errorf("OriginalTime(280) = %d, want 460", got)
+	}
+
+	if _, cuts := RemoveSilence(loud(sr)); cuts != nil {
+		t.Errorf("cuts in audio without silence: %v", cuts)
+	}
+}
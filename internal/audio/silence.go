@@ -0,0 +1,85 @@
+package audio
+
+import "math"
+
+// Silence removal settings, matching the ffmpeg filter enhance_audio used
+// before (silenceremove=stop_periods=-1:stop_duration=0.7:stop_threshold=-45dB).
+const (
+	silenceWindow      = 20 * 16000 / 1000  // RMS window, as in silenceremove
+	silenceThresholdDB = -45                // quieter windows are silence
+	silenceMinDuration = 700 * 16000 / 1000 // shorter pauses are kept
+	silenceKeep        = 100 * 16000 / 1000 // left on both sides of a cut so words do not run together
+)
+
+// Cut is a span of samples [Start, End) removed from the original audio.
+type Cut struct {
+	Start, End int
+}
+
+// Cuts lists the spans RemoveSilence removed, in order. It maps positions
+// in the shortened audio back to the original.
+type Cuts []Cut
+
+// Original maps a sample offset in the shortened audio to the original
+// audio. An offset on a cut maps to the end of the cut, or to its start if
+// isEnd is set, so spans ending there do not stretch over the silence.
+func (c Cuts) Original(offset int, isEnd bool) int {
+	for _, cut := range c {
+		if offset < cut.Start || (isEnd && offset == cut.Start) {
+			break
+		}
+		offset += cut.End - cut.Start
+	}
+	return offset
+}
+
+// OriginalTime is Original for a time in centiseconds, the unit of whisper
+// timestamps.
+func (c Cuts) OriginalTime(t int64, isEnd bool) int64 {
+	return int64(c.Original(int(t*16000/100), isEnd)) * 100 / 16000
+}
+
+// RemoveSilence drops pauses longer than 0.7 seconds from 16kHz mono
+// samples, which can reduce hallucinated repeats. The returned cuts map
+// times in the shortened audio back to the original.
+func RemoveSilence(samples []float32) ([]float32, Cuts) {
+	var cuts Cuts
+	silenceStart := -1
+	for i := 0; i < len(samples); i += silenceWindow {
+		end := min(i+silenceWindow, len(samples))
+		silent := rmsDB(samples[i:end]) < silenceThresholdDB
+		if silent && silenceStart < 0 {
+			silenceStart = i
+		}
+		if silenceStart >= 0 && (!silent || end == len(samples)) {
+			silenceEnd := i
+			if silent {
+				silenceEnd = end // silence runs to the end of the audio
+			}
+			if silenceEnd-silenceStart >= silenceMinDuration {
+				cuts = append(cuts, Cut{silenceStart + silenceKeep, silenceEnd - silenceKeep})
+			}
+			silenceStart = -1
+		}
+	}
+	if len(cuts) == 0 {
+		return samples, nil
+	}
+
+	out := make([]float32, 0, len(samples))
+	prev := 0
+	for _, cut := range cuts {
+		out = append(out, samples[prev:cut.Start]...)
+		prev = cut.End
+	}
+	return append(out, samples[prev:]...), cuts
+}
+
+// rmsDB returns the RMS level of samples in dBFS.
+func rmsDB(samples []float32) float64 {
+	var sum float64
+	for _, v := range samples {
+		sum += float64(v) * float64(v)
+	}
+	return 10 * math.Log10(sum/float64(len(samples))+1e-12)
+}
@@ -1,16 +1,15 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
-	"io"
+	"errors"
 	"log"
 	"net/http"
 	"os"
-	"sync/atomic"
-	"time"
+	"path/filepath"
+	"slices"
 
-	"github.com/thewh1teagle/sona/internal/audio"
-	"github.com/thewh1teagle/sona/internal/diarize"
 	"github.com/thewh1teagle/sona/internal/whisper"
 )
 
@@ -20,15 +19,14 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// handleReady returns 200 if a model is loaded, 503 otherwise.
+// handleReady returns 200 if at least one model is loaded, 503 otherwise.
 func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	s.mu.Lock()
-	loaded := s.ctx != nil
-	name := s.modelName
-	s.mu.Unlock()
+	s.mu.RLock()
+	names := slices.Clone(s.modelOrder)
+	s.mu.RUnlock()
 
-	if !loaded {
+	if len(names) == 0 {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		json.NewEncoder(w).Encode(map[string]string{
 			"status":  "not_ready",
@@ -36,21 +34,56 @@ func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	json.NewEncoder(w).Encode(map[string]string{
+	resp := map[string]any{
 		"status": "ready",
-		"model":  name,
-	})
+		"model":  names[0],
+		"models": names,
+	}
+	if loading := s.loadingModels(); len(loading) > 0 {
+		resp["loading"] = loading
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
-// handleModelLoad loads a model from a path in the JSON body.
+// handleModelLoad loads a model, alongside any models that are already
+// loaded, from a path in the JSON body or by its ID in the models directory.
+// A model with the same ID keeps serving until the new one has loaded.
 func (s *Server) handleModelLoad(w http.ResponseWriter, r *http.Request) {
 	var body struct {
-		Path      string `json:"path"`
+		Path      string `json:"path,omitempty"`       // optional with a models dir
+		ID        string `json:"id,omitempty"`         // optional with path; defaults to the file name
 		GpuDevice *int   `json:"gpu_device,omitempty"` // optional; nil = whisper default
 		NoGpu     bool   `json:"no_gpu,omitempty"`
+		Async     bool   `json:"async,omitempty"` // load in the background and return 202
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || (body.Path == "" && body.ID == "") {
+		writeError(w, http.StatusBadRequest, "request body must contain {\"path\": \"...\"} or {\"id\": \"...\"}")
+		return
+	}
+	if body.Path == "" {
+		if s.ModelsDir == "" {
+			writeError(w, http.StatusBadRequest, "loading by id requires a models directory (--models-dir)")
+			return
+		}
+		path, err := s.findModelFile(body.ID)
+		if errors.Is(err, errModelNotFound) {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			log.Printf("failed to scan models directory: %v", err)
+			writeError(w, http.StatusInternalServerError, "failed to scan models directory")
+			return
+		}
+		body.Path = path
+	}
+	if body.ID == "" {
+		// Name the model after the path the client gave, not its symlink target.
+		body.ID = filepath.Base(body.Path)
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Path == "" {
-		writeError(w, http.StatusBadRequest, "request body must contain {\"path\": \"...\"}")
+	path, err := s.resolveClientPath(body.Path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid model path: "+err.Error())
 		return
 	}
 
@@ -59,286 +92,242 @@ func (s *Server) handleModelLoad(w http.ResponseWriter, r *http.Request) {
 		gpuDevice = *body.GpuDevice
 	}
 
-	if err := s.LoadModel(body.Path, gpuDevice, body.NoGpu); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to load model: "+err.Error())
+	if body.Async {
+		l := s.startModelLoad(body.ID, path, gpuDevice, body.NoGpu)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/v1/models/load/"+l.id)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(l)
+		return
+	}
+
+	name, err := s.LoadModel(body.ID, path, gpuDevice, body.NoGpu)
+	if err != nil {
+		// The error names the file on disk; keep it in the log.
+		log.Printf("failed to load model %s: %v", body.ID, err)
+		writeError(w, http.StatusInternalServerError, "failed to load model "+body.ID)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
 		"status": "loaded",
-		"model":  s.modelName,
+		"model":  name,
 	})
 }
 
-// handleModelUnload frees the loaded model.
+// handleModelUnload frees all loaded models.
 func (s *Server) handleModelUnload(w http.ResponseWriter, r *http.Request) {
-	s.UnloadModel()
+	s.UnloadAllModels()
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "unloaded"})
 }
 
-// handleTranscription processes an audio file and returns the result
-// in the requested format. Rejects concurrent requests with 429.
-func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
-	// Reject if busy (one job at a time).
-	if !s.mu.TryLock() {
-		writeError(w, http.StatusTooManyRequests, "server is busy with another transcription")
+// handleModelUnloadOne frees a single model by name.
+func (s *Server) handleModelUnloadOne(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("id")
+	if !s.UnloadModel(name) {
+		writeError(w, http.StatusNotFound, "model not loaded: "+name)
 		return
 	}
-	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "unloaded",
+		"model":  name,
+	})
+}
+
+// handleTranscription processes an audio file and returns the result
+// in the requested format. Requests wait in the FIFO queue while another
+// transcription runs; 429 is returned only when the queue is full.
+func (s *Server) handleTranscription(w http.ResponseWriter, r *http.Request) {
+	s.serveTranscription(w, r, false)
+}
 
-	if s.ctx == nil {
+// handleTranslation is the OpenAI-compatible translation endpoint: the same
+// multipart contract as handleTranscription, always translating to English.
+func (s *Server) handleTranslation(w http.ResponseWriter, r *http.Request) {
+	s.serveTranscription(w, r, true)
+}
+
+func (s *Server) serveTranscription(w http.ResponseWriter, r *http.Request, translate bool) {
+	if !s.modelLoaded() {
 		writeError(w, http.StatusServiceUnavailable, "no model loaded")
 		return
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	// The request ID is returned in X-Request-Id so the transcription can be
+	// cancelled through DELETE /v1/audio/transcriptions/{id}.
+	ctx, _, stop := s.startRequest(w, r)
+	defer stop()
 
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "missing or invalid 'file' field: "+err.Error())
+	req, ok := s.parseTranscriptionRequest(w, r)
+	if !ok {
 		return
 	}
-	defer file.Close()
-
-	diarizeModel := r.FormValue("diarize_model")
-
-	// If diarization requested, save upload to temp file, then convert to
-	// native 16kHz mono PCM WAV so sona-diarize can read it. The converted
-	// file is also used for whisper (skips its own ffmpeg pass).
-	var tempAudioPath string
-	var fileReader io.ReadSeeker = file
-	if diarizeModel != "" {
-		tmp, tmpErr := os.CreateTemp("", "sona-diar-*.audio")
-		if tmpErr != nil {
-			writeError(w, http.StatusInternalServerError, "failed to create temp file: "+tmpErr.Error())
-			return
-		}
-		defer os.Remove(tmp.Name())
-		if _, copyErr := io.Copy(tmp, file); copyErr != nil {
-			tmp.Close()
-			writeError(w, http.StatusInternalServerError, "failed to buffer upload: "+copyErr.Error())
-			return
-		}
-		tmp.Close()
-
-		// Convert to native WAV for diarization (and reuse for whisper).
-		nativeWav := tmp.Name() + ".wav"
-		if convErr := audio.ConvertToNativeWav(tmp.Name(), nativeWav, false); convErr != nil {
-			log.Printf("failed to convert audio to native WAV: %v", convErr)
-			writeError(w, http.StatusBadRequest, "failed to convert audio for diarization: "+convErr.Error())
-			return
-		}
-		defer os.Remove(nativeWav)
-		tempAudioPath = nativeWav
-
-		// Reopen converted file for audio decoding
-		reopened, reopenErr := os.Open(nativeWav)
-		if reopenErr != nil {
-			writeError(w, http.StatusInternalServerError, "failed to reopen converted file: "+reopenErr.Error())
-			return
+	defer req.Close()
+	if !s.checkModel(w, req.model) {
+		return
+	}
+	if translate {
+		req.opts.Translate = true
+		if req.opts.Language == "" {
+			// whisper.cpp assumes English input by default; let it detect
+			// the source language instead.
+			req.opts.Language = "auto"
 		}
-		defer reopened.Close()
-		fileReader = reopened
 	}
 
-	samples, err := audio.ReadWithOptions(fileReader, audio.ReadOptions{
-		EnhanceAudio: parseBoolFormValue(r.FormValue("enhance_audio")),
-	})
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid audio file: "+err.Error())
+	if req.stream {
+		s.handleStreamingTranscription(ctx, w, req)
 		return
 	}
 
-	// Start diarization in background if requested.
-	type diarResult struct {
-		segments []diarize.Segment
-		err      error
+	// A cached result is returned without queueing.
+	if result, ok := s.cachedResult(req); ok {
+		writeResult(w, req.responseFormat, result, collectDiarization(s.startDiarization(req)))
+		return
 	}
+
+	// Non-streaming: cancellation or the client disconnecting ends ctx,
+	// which aborts inference or drops the request from the queue.
+	var result whisper.TranscribeResult
+	var err error
 	var diarCh chan diarResult
-	if diarizeModel != "" && tempAudioPath != "" {
-		diarCh = make(chan diarResult, 1)
-		go func() {
-			segs, dErr := diarize.Diarize(diarizeModel, tempAudioPath)
-			diarCh <- diarResult{segs, dErr}
-		}()
+	if qErr := s.submit(ctx, func() {
+		// Start diarization in background if requested.
+		diarCh = s.startDiarization(req)
+		result, err = s.transcribeRequest(ctx, req, whisper.StreamCallbacks{})
+	}); qErr != nil {
+		writeError(w, http.StatusTooManyRequests, qErr.Error())
+		return
 	}
-
-	samplingStrategy := r.FormValue("sampling_strategy")
-	opts := whisper.TranscribeOptions{
-		Language:       r.FormValue("language"),
-		DetectLanguage: parseBoolFormValue(r.FormValue("detect_language")),
-		Translate:      parseBoolFormValue(r.FormValue("translate")),
-		Threads:        parseIntFormValue(r.FormValue("n_threads")),
-		Prompt:         r.FormValue("prompt"),
-		Verbose:        s.verbose,
-		Temperature:    parseFloatFormValue(r.FormValue("temperature")),
-		MaxTextCtx:     parseIntFormValue(r.FormValue("max_text_ctx")),
-		WordTimestamps: parseBoolFormValue(r.FormValue("word_timestamps")),
-		MaxSegmentLen:  parseIntFormValue(r.FormValue("max_segment_len")),
-		SamplingGreedy: samplingStrategy != "beam_search",
-		BestOf:         parseIntFormValue(r.FormValue("best_of")),
-		BeamSize:       parseIntFormValue(r.FormValue("beam_size")),
+	if reason := abortReason(ctx); reason != nil {
+		writeAbortError(w, reason)
+		return
 	}
-
-	responseFormat := r.FormValue("response_format")
-	if responseFormat == "" {
-		responseFormat = "json"
+	if ctx.Err() != nil {
+		return // client gone, nothing to write
 	}
-
-	stream := parseBoolFormValue(r.FormValue("stream"))
-
-	if stream {
-		// Run diarization before streaming so speaker labels are available for each segment.
-		var diarStreamSegments []diarize.Segment
-		if diarizeModel != "" && tempAudioPath != "" {
-			segs, dErr := diarize.Diarize(diarizeModel, tempAudioPath)
-			if dErr != nil {
-				log.Printf("diarization failed (streaming without speakers): %v", dErr)
-			} else {
-				diarStreamSegments = segs
-			}
-		}
-		s.handleStreamingTranscription(w, r, samples, opts, diarStreamSegments)
+	if writeModelError(w, err) {
 		return
 	}
-
-	// Non-streaming: set up abort on client disconnect.
-	var aborted atomic.Bool
-	go func() {
-		<-r.Context().Done()
-		aborted.Store(true)
-	}()
-
-	result, err := s.ctx.TranscribeStream(samples, opts, whisper.StreamCallbacks{
-		ShouldAbort: func() bool { return aborted.Load() },
-	})
 	if err != nil {
-		if aborted.Load() {
-			return // client gone, nothing to write
-		}
 		writeError(w, http.StatusInternalServerError, "transcription failed: "+err.Error())
 		return
 	}
 
 	// Collect diarization results (skip silently on failure).
-	var diarSegments []diarize.Segment
-	if diarCh != nil {
-		dr := <-diarCh
-		if dr.err != nil {
-			log.Printf("diarization failed (skipping): %v", dr.err)
-		} else {
-			diarSegments = dr.segments
-		}
-	}
-
-	switch responseFormat {
-	case "verbose_json":
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(buildVerboseJSON(result.Segments, diarSegments))
-	case "text":
-		w.Header().Set("Content-Type", "text/plain")
-		io.WriteString(w, result.Text())
-	case "srt":
-		w.Header().Set("Content-Type", "text/plain")
-		io.WriteString(w, formatSRT(result.Segments))
-	case "vtt":
-		w.Header().Set("Content-Type", "text/plain")
-		io.WriteString(w, formatVTT(result.Segments))
-	default: // "json"
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"text": result.Text()})
-	}
+	writeResult(w, req.responseFormat, result, collectDiarization(diarCh))
 }
 
-// handleStreamingTranscription writes newline-delimited JSON events
-// as segments and progress updates arrive during transcription.
-func (s *Server) handleStreamingTranscription(w http.ResponseWriter, r *http.Request, samples []float32, opts whisper.TranscribeOptions, diarSegments []diarize.Segment) {
+// handleStreamingTranscription writes NDJSON or SSE events as segments and
+// progress updates arrive during transcription.
+// Headers are written once the request leaves the queue.
+func (s *Server) handleStreamingTranscription(ctx context.Context, w http.ResponseWriter, req *transcriptionRequest) {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		writeError(w, http.StatusInternalServerError, "streaming not supported")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/x-ndjson")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.WriteHeader(http.StatusOK)
-
-	enc := json.NewEncoder(w)
-
-	var aborted atomic.Bool
-	go func() {
-		<-r.Context().Done()
-		aborted.Store(true)
-	}()
-
-	cb := whisper.StreamCallbacks{
-		OnProgress: func(progress int) {
-			enc.Encode(map[string]any{
-				"type":     "progress",
-				"progress": progress,
-			})
-			flusher.Flush()
-		},
-		OnSegment: func(seg whisper.Segment) {
-			event := map[string]any{
-				"type":  "segment",
-				"start": csToSeconds(seg.Start),
-				"end":   csToSeconds(seg.End),
-				"text":  seg.Text,
-			}
-			if diarSegments != nil {
-				if sp := matchSpeaker(csToSeconds(seg.Start), csToSeconds(seg.End), diarSegments); sp >= 0 {
-					event["speaker"] = sp
-				}
-			}
-			enc.Encode(event)
-			flusher.Flush()
-		},
-		ShouldAbort: func() bool { return aborted.Load() },
+	// Run diarization before streaming so speaker labels are available for each segment.
+	newStream := func() *eventStream {
+		return &eventStream{
+			w:            w,
+			flusher:      flusher,
+			sse:          req.sse,
+			diarSegments: collectDiarization(s.startDiarization(req)),
+		}
 	}
 
-	result, err := s.ctx.TranscribeStream(samples, opts, cb)
-	if err != nil {
-		if !aborted.Load() {
-			enc.Encode(map[string]any{
-				"type":    "error",
-				"message": err.Error(),
-			})
-			flusher.Flush()
-		}
+	// A cached result is replayed without queueing.
+	if result, ok := s.cachedResult(req); ok {
+		es := newStream()
+		es.start()
+		es.replay(result)
 		return
 	}
 
-	// Final result line.
-	enc.Encode(map[string]any{
-		"type": "result",
-		"text": result.Text(),
+	started := false
+	qErr := s.submit(ctx, func() {
+		if !s.checkModel(w, req.model) {
+			return
+		}
+
+		es := newStream()
+		started = true
+		es.start()
+
+		cb := whisper.StreamCallbacks{
+			OnProgress: es.progress,
+			OnSegment:  es.segment,
+		}
+
+		result, err := s.transcribeRequest(ctx, req, cb)
+		if err != nil {
+			if reason := abortReason(ctx); reason != nil {
+				err = reason // e.g. "server shutting down"
+			} else if ctx.Err() != nil {
+				return // client gone
+			}
+			es.fail(err.Error())
+			return
+		}
+
+		// Final result event.
+		es.done(result)
 	})
-	flusher.Flush()
+	if qErr != nil {
+		writeError(w, http.StatusTooManyRequests, qErr.Error())
+		return
+	}
+	if reason := abortReason(ctx); !started && reason != nil {
+		writeAbortError(w, reason)
+	}
 }
 
+// handleModels lists the loaded models in load order, followed by the
+// models in the models directory that are not loaded.
 func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
-	s.mu.Lock()
-	name := s.modelName
-	loaded := s.ctx != nil
-	s.mu.Unlock()
-
-	var data []map[string]any
-	if loaded {
-		data = []map[string]any{
-			{
-				"id":       name,
-				"object":   "model",
-				"created":  time.Now().Unix(),
-				"owned_by": "local",
-			},
+	files, err := s.scanModelsDir()
+	if err != nil {
+		log.Printf("failed to scan models directory: %v", err)
+	}
+
+	s.mu.RLock()
+	data := make([]map[string]any, 0, len(s.modelOrder)+len(files))
+	for _, name := range s.modelOrder {
+		m := s.models[name]
+		loaded, loadedAt := m.loadState()
+		entry := map[string]any{
+			"id":       name,
+			"object":   "model",
+			"created":  loadedAt.Unix(),
+			"owned_by": "local",
+			"loaded":   loaded, // false after an idle unload
+		}
+		if info, err := os.Stat(m.path); err == nil {
+			entry["size"] = info.Size()
+			entry["modified_at"] = info.ModTime().Unix()
 		}
-	} else {
-		data = []map[string]any{}
+		data = append(data, entry)
+	}
+	for _, f := range files {
+		if _, ok := s.models[f.id]; ok {
+			continue
+		}
+		data = append(data, map[string]any{
+			"id":          f.id,
+			"object":      "model",
+			"created":     f.modTime.Unix(),
+			"owned_by":    "local",
+			"loaded":      false,
+			"size":        f.size,
+			"modified_at": f.modTime.Unix(),
+		})
 	}
+	s.mu.RUnlock()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
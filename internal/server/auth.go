@@ -0,0 +1,61 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// requireAPIKey rejects requests without a valid "Authorization: Bearer"
+// header. /health stays open so supervisors can probe the process.
+func (s *Server) requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" || s.validAPIKey(r.Header.Get("Authorization")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="sona"`)
+		writeError(w, http.StatusUnauthorized, "invalid or missing API key")
+	})
+}
+
+// validAPIKey reports whether an Authorization header value carries one of
+// the configured keys.
+func (s *Server) validAPIKey(header string) bool {
+	scheme, key, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	key = strings.TrimSpace(key)
+	valid := false
+	for _, k := range s.APIKeys {
+		// Compare against every key so timing does not reveal which matched.
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// ReadAPIKeys reads API keys from a file, one per line. Blank lines and
+// lines starting with # are ignored.
+func ReadAPIKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys, sc.Err()
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	s := New(false)
+	s.APIKeys = []string{"sk-one", "sk-two"}
+	h := s.Handler()
+
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{"/health", "", http.StatusOK},
+		{"/v1/models", "", http.StatusUnauthorized},
+		{"/v1/models", "Bearer wrong", http.StatusUnauthorized},
+		{"/v1/models", "Basic sk-one", http.StatusUnauthorized},
+		{"/v1/models", "Bearer sk-one", http.StatusOK},
+		{"/v1/models", "bearer sk-two", http.StatusOK},
+		{"/openapi.json", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("GET %s (%q) = %d, want %d", tt.path, tt.header, w.Code, tt.want)
+		}
+	}
+}
+
+func TestNoAPIKeysDisablesAuth(t *testing.T) {
+	w := httptest.NewRecorder()
+	New(false).Handler().ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestReadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("# comment\nsk-one\n\n  sk-two  \n"), 0o600)
+
+	keys, err := ReadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"sk-one", "sk-two"}; !slices.Equal(keys, want) {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// cacheFileExt is the extension of cached results in the cache directory.
+const cacheFileExt = ".json"
+
+// resultCache is an on-disk cache of transcription results, capped at
+// maxBytes and evicted least recently used first. File modification times
+// record use, so the order survives restarts.
+type resultCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List // of *cacheEntry, most recently used at the front
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+// openResultCache creates dir if needed and indexes the results already in
+// it, evicting down to maxBytes.
+func openResultCache(dir string, maxBytes int64) (*resultCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	for _, e := range dirEntries {
+		key, ok := strings.CutSuffix(e.Name(), cacheFileExt)
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{key, info.Size(), info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b file) int { return b.modTime.Compare(a.modTime) })
+
+	c := &resultCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+	for _, f := range files {
+		c.entries[f.key] = c.lru.PushBack(&cacheEntry{f.key, f.size})
+		c.size += f.size
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.dir, key+cacheFileExt)
+}
+
+// get returns the cached result for key and marks it as recently used.
+func (c *resultCache) get(key string) (whisper.TranscribeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return whisper.TranscribeResult{}, false
+	}
+	var result whisper.TranscribeResult
+	data, err := os.ReadFile(c.path(key))
+	if err == nil {
+		err = json.Unmarshal(data, &result)
+	}
+	if err != nil {
+		log.Printf("dropping unreadable cache entry %s: %v", key, err)
+		c.removeLocked(el)
+		return whisper.TranscribeResult{}, false
+	}
+	c.lru.MoveToFront(el)
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return result, true
+}
+
+// put stores result under key, evicting the least recently used results
+// beyond maxBytes. Results larger than maxBytes are not stored.
+func (c *resultCache) put(key string, result whisper.TranscribeResult) {
+	data, err := json.Marshal(result)
+	if err != nil || int64(len(data)) > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.removeLocked(el)
+	}
+	// Write to a temp file first so a crash never leaves a partial entry.
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		log.Printf("failed to write cache entry: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("failed to write cache entry: %v", err)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key, int64(len(data))})
+	c.size += int64(len(data))
+	c.evictLocked()
+}
+
+func (c *resultCache) evictLocked() {
+	for c.size > c.maxBytes && c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+func (c *resultCache) removeLocked(el *list.Element) {
+	e := c.lru.Remove(el).(*cacheEntry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	os.Remove(c.path(e.key))
+}
+
+// EnableCache stores transcription results in dir, keeping at most maxBytes.
+// Resubmitting the same audio with the same model and options then returns
+// the stored result without running whisper. Must be called before the
+// first request is served.
+func (s *Server) EnableCache(dir string, maxBytes int64) error {
+	c, err := openResultCache(dir, maxBytes)
+	if err != nil {
+		return err
+	}
+	s.cache = c
+	return nil
+}
+
+// cachedResult returns the stored result for req, with segment times
+// mapped to the uploaded audio. Handlers call it before queueing, so a hit
+// is served without waiting for a worker. It also records the cache key in
+// req, under which transcribeRequest stores the result of a miss.
+func (s *Server) cachedResult(req *transcriptionRequest) (whisper.TranscribeResult, bool) {
+	if s.cache == nil {
+		return whisper.TranscribeResult{}, false
+	}
+	req.cacheKey = s.cacheKey(req.model, req.samples, req.opts)
+	if req.cacheKey == "" {
+		return whisper.TranscribeResult{}, false
+	}
+	result, ok := s.cache.get(req.cacheKey)
+	s.metrics.observeCacheLookup(ok)
+	if !ok {
+		return whisper.TranscribeResult{}, false
+	}
+	s.applyKeepAlive(req)
+	if len(req.cuts) > 0 {
+		result = result.MapTimes(req.cuts.OriginalTime)
+	}
+	return result, true
+}
+
+// cacheKey identifies a transcription by the decoded samples, the model
+// file and every option that affects the result. It returns "" if the model
+// cannot be resolved.
+func (s *Server) cacheKey(modelName string, samples []float32, opts whisper.TranscribeOptions) string {
+	s.mu.RLock()
+	m, err := s.resolveModelLocked(modelName)
+	s.mu.RUnlock()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return ""
+	}
+
+	// Threads and Verbose do not change the output.
+	opts.Threads = 0
+	opts.Verbose = false
+	optsJSON, _ := json.Marshal(opts)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "sona-cache-v2\n%s\n%d\n%d\n%s\n", m.path, info.Size(), info.ModTime().UnixNano(), optsJSON)
+	hashSamples(h, samples)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashSamples writes samples to h as little-endian float32 bits.
+func hashSamples(h hash.Hash, samples []float32) {
+	buf := make([]byte, 0, 64<<10)
+	for _, v := range samples {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+		if len(buf) == cap(buf) {
+			h.Write(buf)
+			buf = buf[:0]
+		}
+	}
+	h.Write(buf)
+}
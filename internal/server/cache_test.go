@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func resultOfSize(t *testing.T, text string) (whisper.TranscribeResult, int64) {
+	t.Helper()
+	r := whisper.TranscribeResult{Segments: []whisper.Segment{{Start: 0, End: 100, Text: text}}}
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, int64(len(data))
+}
+
+func TestResultCacheLRU(t *testing.T) {
+	dir := t.TempDir()
+	a, size := resultOfSize(t, "aaaa")
+	b, _ := resultOfSize(t, "bbbb")
+	c, _ := resultOfSize(t, "cccc")
+
+	cache, err := openResultCache(dir, 2*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.put("a", a)
+	cache.put("b", b)
+	if _, ok := cache.get("a"); !ok { // a is now more recent than b
+		t.Fatal("expected a hit for a")
+	}
+	cache.put("c", c)
+	if _, ok := cache.get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b"+cacheFileExt)); !os.IsNotExist(err) {
+		t.Error("evicted entry should be removed from disk")
+	}
+
+	// Reopening keeps the entries; a limit of one entry keeps the most
+	// recently used.
+	reopened, err := openResultCache(dir, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.get("c")
+	if !ok || got.Segments[0].Text != "cccc" {
+		t.Errorf("expected c to survive reopening, got %v %v", got, ok)
+	}
+	if _, ok := reopened.get("a"); ok {
+		t.Error("a should have been evicted on reopening")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	s := New(false)
+	modelPath := filepath.Join(t.TempDir(), "ggml-tiny.bin")
+	os.WriteFile(modelPath, []byte("weights"), 0o644)
+	addFakeModel(s, "tiny")
+	s.models["tiny"].path = modelPath
+
+	samples := []float32{0.1, 0.2, 0.3}
+	opts := whisper.TranscribeOptions{Language: "en"}
+	key := s.cacheKey("tiny", samples, opts)
+	if key == "" {
+		t.Fatal("expected a key for a model file on disk")
+	}
+
+	threads := opts
+	threads.Threads = 4
+	if s.cacheKey("tiny", samples, threads) != key {
+		t.Error("Threads should not affect the key")
+	}
+	translate := opts
+	translate.Translate = true
+	if s.cacheKey("tiny", samples, translate) == key {
+		t.Error("Translate should change the key")
+	}
+	if s.cacheKey("tiny", []float32{0.1, 0.2, 0.4}, opts) == key {
+		t.Error("different audio should change the key")
+	}
+	if s.cacheKey("missing", samples, opts) != "" {
+		t.Error("unknown model should not be cacheable")
+	}
+}
+
+// nativeWav returns a 16kHz mono 16-bit PCM WAV of silence.
+func nativeWav(seconds int) []byte {
+	dataSize := uint32(seconds * 16000 * 2)
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, 36+dataSize)
+	b.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(1), uint16(1), uint32(16000), uint32(32000), uint16(2), uint16(16)} {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	b.WriteString("data")
+	binary.Write(&b, binary.LittleEndian, dataSize)
+	b.Write(make([]byte, dataSize))
+	return b.Bytes()
+}
+
+// uploadRequest returns a multipart upload of audio to target with the
+// given form fields.
+func uploadRequest(target string, audio []byte, fields map[string]string) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "audio.wav")
+	fw.Write(audio)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", target, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestCacheHitSkipsQueue(t *testing.T) {
+	s := New(false)
+	s.QueueDepth = 1
+	if err := s.EnableCache(t.TempDir(), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	modelPath := filepath.Join(t.TempDir(), "ggml-tiny.bin")
+	os.WriteFile(modelPath, []byte("weights"), 0o644)
+	addFakeModel(s, "tiny")
+	s.models["tiny"].path = modelPath
+
+	// Seed the cache under the key the upload resolves to.
+	req, ok := s.parseTranscriptionRequest(httptest.NewRecorder(), uploadRequest("/v1/audio/transcriptions", nativeWav(1), nil))
+	if !ok {
+		t.Fatal("failed to parse upload")
+	}
+	req.Close()
+	if _, ok := s.cachedResult(req); ok || req.cacheKey == "" {
+		t.Fatal("expected a cacheable miss")
+	}
+	want, _ := resultOfSize(t, " Hello")
+	s.cache.put(req.cacheKey, want)
+
+	// Fill the worker and the queue; the fake model has no weights, so only
+	// a cache hit served without queueing can succeed.
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	s.enqueue(newTask(context.Background(), func() {
+		close(started)
+		<-release
+	}))
+	<-started
+	s.enqueue(newTask(context.Background(), func() {}))
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, uploadRequest("/v1/audio/transcriptions", nativeWav(1), map[string]string{"response_format": "text"}))
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "Hello" {
+		t.Errorf("transcription: got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, uploadRequest("/v1/audio/transcriptions", nativeWav(1), map[string]string{"stream": "true", "stream_format": "ndjson"}))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"progress":100`) || !strings.Contains(w.Body.String(), `"text":" Hello","type":"result"`) {
+		t.Errorf("stream: got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, uploadRequest("/v1/jobs", nativeWav(1), nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("job: got %d %s", w.Code, w.Body.String())
+	}
+	j := s.getJob(w.Header().Get(requestIDHeader))
+	for range 100 {
+		if j.finished() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	j.mu.Lock()
+	status := j.statusLocked()
+	j.mu.Unlock()
+	if status != jobCompleted {
+		t.Errorf("job status = %s, want completed", status)
+	}
+	if j.ctx.Err() == nil {
+		t.Error("finished job should release its context")
+	}
+
+	if out := scrape(t, s); !strings.Contains(out, "sona_cache_hits_total 3") {
+		t.Errorf("expected cache hits in metrics:\n%s", out)
+	}
+}
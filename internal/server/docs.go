@@ -15,9 +15,16 @@ type docsTranscriptionForm struct {
 	Prompt         string        `form:"prompt"`
 	DetectLanguage string        `form:"detect_language"`
 	EnhanceAudio   string        `form:"enhance_audio"`
+	VAD            string        `form:"vad" doc:"Transcribe only detected speech; timestamps still refer to the uploaded audio"`
+	Grammar        string        `form:"grammar" doc:"GBNF grammar that constrains the transcript"`
+	GrammarRule    string        `form:"grammar_rule" doc:"Start rule of grammar (default root)"`
+	GrammarPenalty float64       `form:"grammar_penalty" doc:"Penalty for tokens outside the grammar, 0-1000 (default 100)"`
 	ResponseFormat string        `form:"response_format"`
 	Stream         string        `form:"stream"`
+	StreamFormat   string        `form:"stream_format" enum:"sse,ndjson" doc:"sse (default) streams OpenAI-style transcript.text.delta events; ndjson streams sona's progress/segment/result events"`
 	Model          string        `form:"model"`
+	KeepAlive      string        `form:"keep_alive" doc:"How long the model stays loaded after this request, e.g. 5m or seconds; 0 unloads right away, negative keeps it loaded"`
+	Granularities  []string      `form:"timestamp_granularities[]" enum:"word,segment" doc:"word adds a top-level words list to verbose_json"`
 }
 
 type docsTranscriptionInput struct {
@@ -30,16 +37,80 @@ type docsTranscriptionOutput struct {
 	}
 }
 
+type docsLanguageForm struct {
+	File     huma.FormFile `form:"file"`
+	Model    string        `form:"model"`
+	TopK     int           `form:"top_k" doc:"Number of languages to return (default 5)"`
+	Duration float64       `form:"duration" doc:"Seconds from the start of the audio to analyze, 1-30 (default 30)"`
+	NThreads int           `form:"n_threads"`
+}
+
+type docsLanguageInput struct {
+	RawBody huma.MultipartFormFiles[docsLanguageForm]
+}
+
+type docsLanguageProb struct {
+	Language    string  `json:"language" example:"en"`
+	Name        string  `json:"name" example:"english"`
+	Probability float32 `json:"probability"`
+}
+
+type docsLanguageOutput struct {
+	Body struct {
+		Language    string             `json:"language" doc:"Most likely language"`
+		Probability float32            `json:"probability"`
+		Languages   []docsLanguageProb `json:"languages" doc:"Top languages, most likely first"`
+	}
+}
+
+type docsJobInput struct {
+	RawBody huma.MultipartFormFiles[docsTranscriptionForm]
+}
+
+type docsJobOutput struct {
+	Body struct {
+		ID             string `json:"id"`
+		Object         string `json:"object"`
+		Status         string `json:"status" enum:"queued,running,completed,failed,cancelled"`
+		Progress       int    `json:"progress"`
+		ResponseFormat string `json:"response_format"`
+		CreatedAt      int64  `json:"created_at"`
+		FinishedAt     int64  `json:"finished_at,omitempty"`
+		Result         any    `json:"result,omitempty"`
+	}
+}
+
+type docsJobGetInput struct {
+	ID string `path:"id"`
+}
+
+type docsCancelInput struct {
+	ID string `path:"id" doc:"Request ID from the X-Request-Id response header, or a job ID"`
+}
+
+type docsCancelOutput struct {
+	Body struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+}
+
 type docsModelsOutput struct {
 	Body map[string]any
 }
 
 type docsModelLoadInput struct {
 	Body struct {
-		Path string `json:"path"`
+		Path  string `json:"path,omitempty" doc:"Model file; optional when id names a model in --models-dir"`
+		ID    string `json:"id,omitempty" doc:"Name to register the model under (default: file name), or a model in --models-dir to load"`
+		Async bool   `json:"async,omitempty" doc:"Load in the background; returns 202 with a load ID to poll"`
 	}
 }
 
+type docsModelUnloadInput struct {
+	ID string `path:"id"`
+}
+
 type docsModelLoadOutput struct {
 	Body struct {
 		Status string `json:"status"`
@@ -47,6 +118,20 @@ type docsModelLoadOutput struct {
 	}
 }
 
+type docsModelLoadGetInput struct {
+	ID string `path:"id" doc:"Load ID returned by an async POST /v1/models/load"`
+}
+
+type docsModelLoadStatusOutput struct {
+	Body struct {
+		ID       string `json:"id"`
+		Object   string `json:"object" example:"model.load"`
+		Model    string `json:"model"`
+		Status   string `json:"status" enum:"loading,loaded,failed"`
+		Progress int    `json:"progress" doc:"Percentage of the model file read"`
+	}
+}
+
 type docsStatusOutput struct {
 	Body struct {
 		Status string `json:"status"`
@@ -55,8 +140,9 @@ type docsStatusOutput struct {
 
 type docsReadyOutput struct {
 	Body struct {
-		Status string `json:"status"`
-		Model  string `json:"model,omitempty"`
+		Status string   `json:"status"`
+		Model  string   `json:"model,omitempty" doc:"Default model"`
+		Models []string `json:"models,omitempty"`
 	}
 }
 
@@ -64,6 +150,12 @@ func (s *Server) registerDocsRoutes(mux *http.ServeMux) {
 	docsMux := http.NewServeMux()
 	config := huma.DefaultConfig("Sona API", "dev")
 	config.DocsPath = ""
+	if len(s.APIKeys) > 0 {
+		config.Components.SecuritySchemes = map[string]*huma.SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer"},
+		}
+		config.Security = []map[string][]string{{"bearerAuth": {}}}
+	}
 	api := humago.New(docsMux, config)
 
 	huma.Register(api, huma.Operation{
@@ -75,11 +167,67 @@ func (s *Server) registerDocsRoutes(mux *http.ServeMux) {
 		return nil, huma.Error501NotImplemented("spec-only operation")
 	})
 
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/v1/audio/translations",
+		OperationID: "createTranslation",
+		Summary:     "Translate audio into English",
+	}, func(context.Context, *docsTranscriptionInput) (*docsTranscriptionOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodPost,
+		Path:        "/v1/audio/language",
+		OperationID: "detectLanguage",
+		Summary:     "Identify the spoken language without transcribing",
+	}, func(context.Context, *docsLanguageInput) (*docsLanguageOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/v1/audio/transcriptions/{id}",
+		OperationID: "cancelTranscription",
+		Summary:     "Cancel a running or queued transcription",
+		Description: "Non-streaming transcriptions return X-Request-Id only with their result. To cancel one, send your own unique X-Request-Id with the transcription request and use it here.",
+	}, func(context.Context, *docsCancelInput) (*docsCancelOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
+	huma.Register(api, huma.Operation{
+		Method:        http.MethodPost,
+		Path:          "/v1/jobs",
+		OperationID:   "createJob",
+		Summary:       "Queue an asynchronous transcription",
+		DefaultStatus: http.StatusAccepted,
+	}, func(context.Context, *docsJobInput) (*docsJobOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/v1/jobs/{id}",
+		OperationID: "getJob",
+		Summary:     "Get job status, progress and result",
+	}, func(context.Context, *docsJobGetInput) (*docsJobOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/v1/jobs/{id}",
+		OperationID: "cancelJob",
+		Summary:     "Cancel a running or queued job",
+	}, func(context.Context, *docsJobGetInput) (*docsJobOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
 	huma.Register(api, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/v1/models",
 		OperationID: "listModels",
-		Summary:     "List loaded models",
+		Summary:     "List loaded models and models available in --models-dir",
 	}, func(context.Context, *struct{}) (*docsModelsOutput, error) {
 		return nil, huma.Error501NotImplemented("spec-only operation")
 	})
@@ -88,7 +236,7 @@ func (s *Server) registerDocsRoutes(mux *http.ServeMux) {
 		Method:      http.MethodPost,
 		Path:        "/v1/models/load",
 		OperationID: "loadModel",
-		Summary:     "Load a model",
+		Summary:     "Load a model alongside the loaded ones",
 	}, func(context.Context, *docsModelLoadInput) (*docsModelLoadOutput, error) {
 		return nil, huma.Error501NotImplemented("spec-only operation")
 	})
@@ -97,11 +245,29 @@ func (s *Server) registerDocsRoutes(mux *http.ServeMux) {
 		Method:      http.MethodDelete,
 		Path:        "/v1/models",
 		OperationID: "unloadModel",
-		Summary:     "Unload the current model",
+		Summary:     "Unload all models",
 	}, func(context.Context, *struct{}) (*docsStatusOutput, error) {
 		return nil, huma.Error501NotImplemented("spec-only operation")
 	})
 
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodDelete,
+		Path:        "/v1/models/{id}",
+		OperationID: "unloadModelByID",
+		Summary:     "Unload one model",
+	}, func(context.Context, *docsModelUnloadInput) (*docsModelLoadOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
+	huma.Register(api, huma.Operation{
+		Method:      http.MethodGet,
+		Path:        "/v1/models/load/{id}",
+		OperationID: "getModelLoad",
+		Summary:     "Get the status of a background model load",
+	}, func(context.Context, *docsModelLoadGetInput) (*docsModelLoadStatusOutput, error) {
+		return nil, huma.Error501NotImplemented("spec-only operation")
+	})
+
 	huma.Register(api, huma.Operation{
 		Method:      http.MethodGet,
 		Path:        "/health",
@@ -14,3 +14,18 @@ func writeError(w http.ResponseWriter, status int, message string) {
 		},
 	})
 }
+
+// writeInvalidParam writes a 400 OpenAI-style invalid_request_error naming
+// the offending request parameter.
+func writeInvalidParam(w http.ResponseWriter, err *invalidParamError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"message": err.message,
+			"type":    "invalid_request_error",
+			"param":   err.param,
+			"code":    nil,
+		},
+	})
+}
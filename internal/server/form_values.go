@@ -1,24 +1,141 @@
 package server
 
-import "strconv"
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-func parseBoolFormValue(v string) bool {
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// invalidParamError describes a request parameter that failed validation.
+type invalidParamError struct {
+	param   string
+	message string
+}
+
+func (e *invalidParamError) Error() string { return e.message }
+
+// formReader reads typed form values. The first invalid value is kept in
+// err; values read after that are still returned but should be discarded.
+// Empty values are not validated and read as the zero value.
+type formReader struct {
+	r   *http.Request
+	err *invalidParamError
+}
+
+func (f *formReader) fail(param, format string, args ...any) {
+	if f.err == nil {
+		f.err = &invalidParamError{param: param, message: fmt.Sprintf("invalid '%s': %s", param, fmt.Sprintf(format, args...))}
+	}
+}
+
+func (f *formReader) bool(name string) bool {
+	v := f.r.FormValue(name)
+	if v == "" {
+		return false
+	}
 	b, err := strconv.ParseBool(v)
-	return err == nil && b
+	if err != nil {
+		f.fail(name, "expected a boolean, got %q", v)
+	}
+	return b
 }
 
-func parseIntFormValue(v string) int {
+// int reads an integer in [min, max].
+func (f *formReader) int(name string, min, max int) int {
+	v := f.r.FormValue(name)
+	if v == "" {
+		return 0
+	}
 	n, err := strconv.Atoi(v)
 	if err != nil {
+		f.fail(name, "expected an integer, got %q", v)
 		return 0
 	}
+	if n < min || n > max {
+		f.fail(name, "must be between %d and %d, got %d", min, max, n)
+	}
 	return n
 }
 
-func parseFloatFormValue(v string) float32 {
-	f, err := strconv.ParseFloat(v, 32)
+// float reads a number in [min, max].
+func (f *formReader) float(name string, min, max float64) float32 {
+	v := f.r.FormValue(name)
+	if v == "" {
+		return 0
+	}
+	x, err := strconv.ParseFloat(v, 32)
 	if err != nil {
+		f.fail(name, "expected a number, got %q", v)
 		return 0
 	}
-	return float32(f)
+	if math.IsNaN(x) || math.IsInf(x, 0) || x < min || x > max {
+		f.fail(name, "must be between %g and %g, got %g", min, max, x)
+	}
+	return float32(x)
+}
+
+// oneOf reads a value from allowed, returning def if the field is empty.
+func (f *formReader) oneOf(name, def string, allowed ...string) string {
+	v := f.r.FormValue(name)
+	if v == "" {
+		return def
+	}
+	if !slices.Contains(allowed, v) {
+		f.fail(name, "must be one of %s, got %q", strings.Join(allowed, ", "), v)
+	}
+	return v
+}
+
+// list reads every value of a repeated field, each from allowed.
+func (f *formReader) list(name string, allowed ...string) []string {
+	values := f.r.Form[name]
+	for _, v := range values {
+		if !slices.Contains(allowed, v) {
+			f.fail(name, "must be one of %s, got %q", strings.Join(allowed, ", "), v)
+		}
+	}
+	return values
+}
+
+// language reads a language code or name known to whisper, or "auto".
+func (f *formReader) language(name string) string {
+	v := f.r.FormValue(name)
+	if v != "" && v != "auto" && whisper.LanguageID(v) < 0 {
+		f.fail(name, "unsupported language %q", v)
+	}
+	return v
+}
+
+// grammar reads a GBNF grammar and the name of its start rule from the
+// rule field. Parse errors are reported against the grammar field.
+func (f *formReader) grammar(name, ruleName string) (grammar, rule string) {
+	grammar, rule = f.r.FormValue(name), f.r.FormValue(ruleName)
+	if grammar == "" {
+		return "", ""
+	}
+	if _, err := whisper.ParseGrammar(grammar, rule); err != nil {
+		f.fail(name, "%v", err)
+	}
+	return grammar, rule
+}
+
+// keepAlive reads a keep_alive duration (see parseKeepAlive). ok is false
+// when the field is empty or invalid.
+func (f *formReader) keepAlive(name string) (d time.Duration, ok bool) {
+	v := f.r.FormValue(name)
+	if v == "" {
+		return 0, false
+	}
+	d, err := parseKeepAlive(v)
+	if err != nil {
+		f.fail(name, "%v", err)
+		return 0, false
+	}
+	return d, true
 }
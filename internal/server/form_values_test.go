@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func newFormReader(values url.Values) *formReader {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Form = values
+	return &formReader{r: r}
+}
+
+func TestFormReaderBool(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    bool
+		wantErr bool
+	}{
+		{"true", true, false},
+		{"false", false, false},
+		{"1", true, false},
+		{"0", false, false},
+		{"", false, false},
+		{"yes", false, true},
+	}
+	for _, tt := range tests {
+		f := newFormReader(url.Values{"stream": {tt.input}})
+		got := f.bool("stream")
+		if got != tt.want || (f.err != nil) != tt.wantErr {
+			t.Errorf("bool(%q) = %v, err %v; want %v, error %v", tt.input, got, f.err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestFormReaderRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"beam_size", "5", false},
+		{"beam_size", "0", true},
+		{"beam_size", "9", true},
+		{"beam_size", "five", true},
+		{"temperature", "0.4", false},
+		{"temperature", "1.5", true},
+		{"temperature", "-1", true},
+		{"temperature", "hot", true},
+		{"temperature", "NaN", true},
+		{"temperature", "-Inf", true},
+	}
+	for _, tt := range tests {
+		f := newFormReader(url.Values{tt.name: {tt.value}})
+		if tt.name == "temperature" {
+			f.float(tt.name, 0, 1)
+		} else {
+			f.int(tt.name, 1, maxDecoders)
+		}
+		if (f.err != nil) != tt.wantErr {
+			t.Errorf("%s=%s: err = %v, want error %v", tt.name, tt.value, f.err, tt.wantErr)
+		}
+		if f.err != nil && f.err.param != tt.name {
+			t.Errorf("%s=%s: param = %q", tt.name, tt.value, f.err.param)
+		}
+	}
+}
+
+func TestFormReaderKeepsFirstError(t *testing.T) {
+	f := newFormReader(url.Values{
+		"response_format":   {"xml"},
+		"sampling_strategy": {"beam"},
+	})
+	if got := f.oneOf("response_format", "json", "json", "text"); got != "xml" {
+		t.Errorf("oneOf = %q", got)
+	}
+	f.oneOf("sampling_strategy", "greedy", "greedy", "beam_search")
+	if f.err == nil || f.err.param != "response_format" {
+		t.Fatalf("err = %+v, want response_format", f.err)
+	}
+	if f := newFormReader(url.Values{}); f.oneOf("response_format", "json", "json") != "json" || f.err != nil {
+		t.Error("empty value should return the default")
+	}
+}
+
+func TestFormReaderGrammar(t *testing.T) {
+	f := newFormReader(url.Values{"grammar": {`root ::= "yes" | "no"`}})
+	if g, rule := f.grammar("grammar", "grammar_rule"); g == "" || rule != "" || f.err != nil {
+		t.Fatalf("valid grammar: %q, %q, %v", g, rule, f.err)
+	}
+
+	f = newFormReader(url.Values{"grammar": {`root ::= "yes" | "no"`}, "grammar_rule": {"answer"}})
+	f.grammar("grammar", "grammar_rule")
+	if f.err == nil || f.err.param != "grammar" || !strings.Contains(f.err.message, `"answer"`) {
+		t.Errorf("missing start rule: %+v", f.err)
+	}
+
+	f = newFormReader(url.Values{"grammar": {`root ::= ("yes"`}})
+	f.grammar("grammar", "grammar_rule")
+	if f.err == nil || !strings.Contains(f.err.message, "expecting ')'") {
+		t.Errorf("parse error: %+v", f.err)
+	}
+}
+
+func TestTranscriptionInvalidParam(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "audio.wav")
+	fw.Write([]byte("not audio"))
+	mw.WriteField("sampling_strategy", "beam")
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	var resp struct {
+		Error struct {
+			Message string  `json:"message"`
+			Type    string  `json:"type"`
+			Param   string  `json:"param"`
+			Code    *string `json:"code"`
+		} `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error.Type != "invalid_request_error" || resp.Error.Param != "sampling_strategy" {
+		t.Errorf("error = %+v", resp.Error)
+	}
+}
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 
 	"github.com/thewh1teagle/sona/internal/diarize"
@@ -73,29 +76,53 @@ func formatVTT(segments []whisper.Segment) string {
 
 // verboseSegment is the JSON representation of a segment in verbose_json format.
 type verboseSegment struct {
-	Start   float64 `json:"start"`
-	End     float64 `json:"end"`
-	Text    string  `json:"text"`
-	Speaker *int    `json:"speaker,omitempty"`
+	Start        float64 `json:"start"`
+	End          float64 `json:"end"`
+	Text         string  `json:"text"`
+	AvgLogprob   float32 `json:"avg_logprob"`
+	NoSpeechProb float32 `json:"no_speech_prob"`
+	Speaker      *int    `json:"speaker,omitempty"`
+}
+
+// verboseWord is the JSON representation of a word in verbose_json format.
+type verboseWord struct {
+	Word        string  `json:"word"`
+	Start       float64 `json:"start"`
+	End         float64 `json:"end"`
+	Probability float32 `json:"probability"`
 }
 
 // verboseJSON is the response body for response_format=verbose_json.
 type verboseJSON struct {
+	Language string           `json:"language,omitempty"`
 	Text     string           `json:"text"`
 	Segments []verboseSegment `json:"segments"`
+	Words    []verboseWord    `json:"words,omitempty"` // with word timestamps only
 }
 
-// buildVerboseJSON creates the verbose_json response structure.
+// buildVerboseJSON creates the verbose_json response structure. Words of all
+// segments are collected into a top-level list, as in the OpenAI API.
 // If diarSegments is non-nil, each transcription segment is assigned
 // the speaker with maximum time overlap.
 func buildVerboseJSON(segments []whisper.Segment, diarSegments []diarize.Segment) verboseJSON {
 	text := whisper.TranscribeResult{Segments: segments}.Text()
 	vSegs := make([]verboseSegment, len(segments))
+	var words []verboseWord
 	for i, seg := range segments {
+		for _, word := range seg.Words {
+			words = append(words, verboseWord{
+				Word:        word.Text,
+				Start:       csToSeconds(word.Start),
+				End:         csToSeconds(word.End),
+				Probability: word.Probability,
+			})
+		}
 		vSegs[i] = verboseSegment{
-			Start: csToSeconds(seg.Start),
-			End:   csToSeconds(seg.End),
-			Text:  seg.Text,
+			Start:        csToSeconds(seg.Start),
+			End:          csToSeconds(seg.End),
+			Text:         seg.Text,
+			AvgLogprob:   seg.AvgLogprob,
+			NoSpeechProb: seg.NoSpeechProb,
 		}
 		if diarSegments != nil {
 			if sp := matchSpeaker(csToSeconds(seg.Start), csToSeconds(seg.End), diarSegments); sp >= 0 {
@@ -104,7 +131,40 @@ func buildVerboseJSON(segments []whisper.Segment, diarSegments []diarize.Segment
 			}
 		}
 	}
-	return verboseJSON{Text: text, Segments: vSegs}
+	return verboseJSON{Text: text, Segments: vSegs, Words: words}
+}
+
+// renderResult formats a result for the given response_format. Subtitle and
+// text formats are returned as a string, JSON formats as a value to encode.
+// Unknown formats fall back to "json".
+func renderResult(format string, result whisper.TranscribeResult, diarSegments []diarize.Segment) any {
+	segments := result.Segments
+	switch format {
+	case "verbose_json":
+		v := buildVerboseJSON(segments, diarSegments)
+		v.Language = result.Language
+		return v
+	case "text":
+		return whisper.TranscribeResult{Segments: segments}.Text()
+	case "srt":
+		return formatSRT(segments)
+	case "vtt":
+		return formatVTT(segments)
+	default: // "json"
+		return map[string]string{"text": whisper.TranscribeResult{Segments: segments}.Text()}
+	}
+}
+
+// writeResult writes result to w in the given response_format.
+func writeResult(w http.ResponseWriter, format string, result whisper.TranscribeResult, diarSegments []diarize.Segment) {
+	switch v := renderResult(format, result, diarSegments).(type) {
+	case string:
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, v)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	}
 }
 
 // matchSpeaker finds the diarization segment with maximum overlap and
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	"github.com/thewh1teagle/sona/internal/whisper"
@@ -99,22 +101,34 @@ func TestBuildVerboseJSON(t *testing.T) {
 	}
 }
 
-func TestParseBoolFormValue(t *testing.T) {
-	tests := []struct {
-		input string
-		want  bool
-	}{
-		{"true", true},
-		{"false", false},
-		{"1", true},
-		{"0", false},
-		{"", false},
-		{"yes", false},
+func TestBuildVerboseJSONWords(t *testing.T) {
+	segments := []whisper.Segment{
+		{Start: 0, End: 100, Text: " Hello", Words: []whisper.Word{{Start: 0, End: 100, Text: "Hello", Probability: 0.9}}},
+		{Start: 100, End: 200, Text: " world", Words: []whisper.Word{{Start: 120, End: 200, Text: "world", Probability: 0.8}}},
 	}
-	for _, tt := range tests {
-		got := parseBoolFormValue(tt.input)
-		if got != tt.want {
-			t.Errorf("parseBoolFormValue(%q) = %v, want %v", tt.input, got, tt.want)
-		}
+	v := buildVerboseJSON(segments, nil)
+	if len(v.Words) != 2 {
+		t.Fatalf("got %d words, want 2", len(v.Words))
+	}
+	if w := v.Words[1]; w.Word != "world" || w.Start != 1.2 || w.End != 2.0 {
+		t.Errorf("words[1] = %+v", w)
+	}
+
+	// Without word timestamps the field is omitted.
+	data, _ := json.Marshal(buildVerboseJSON([]whisper.Segment{{Text: "Hello"}}, nil))
+	if strings.Contains(string(data), "words") {
+		t.Errorf("unexpected words in %s", data)
+	}
+}
+
+func TestRenderVerboseJSONConfidence(t *testing.T) {
+	result := whisper.TranscribeResult{
+		Language: "he",
+		Segments: []whisper.Segment{{Start: 0, End: 100, Text: " Shalom", AvgLogprob: -0.3, NoSpeechProb: 0.02}},
+	}
+	data, _ := json.Marshal(renderResult("verbose_json", result, nil))
+	want := `{"language":"he","text":" Shalom","segments":[{"start":0,"end":1,"text":" Shalom","avg_logprob":-0.3,"no_speech_prob":0.02}]}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
 	}
 }
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// maxFinishedJobs bounds how many completed/failed jobs are kept for polling.
+const maxFinishedJobs = 100
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// job tracks an asynchronous transcription submitted via POST /v1/jobs.
+type job struct {
+	mu             sync.Mutex
+	id             string
+	ctx            context.Context
+	cancelCtx      context.CancelCauseFunc
+	status         string
+	progress       int
+	createdAt      time.Time
+	finishedAt     time.Time
+	responseFormat string
+	result         any
+	errMessage     string
+}
+
+// setStatus records the job's status. A finished job releases its
+// context, which would otherwise stay registered on the server's base
+// context until shutdown.
+func (j *job) setStatus(status string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+	if isFinishedJobStatus(status) {
+		j.finishedAt = time.Now()
+		j.cancelCtx(context.Canceled)
+	}
+}
+
+// fail marks the job failed with message.
+func (j *job) fail(message string) {
+	j.mu.Lock()
+	j.errMessage = message
+	j.mu.Unlock()
+	j.setStatus(jobFailed)
+}
+
+func isFinishedJobStatus(status string) bool {
+	return status == jobCompleted || status == jobFailed || status == jobCancelled
+}
+
+// statusLocked reports a queued or running job whose context was cancelled as
+// cancelled right away, since the worker skips it or aborts it shortly.
+func (j *job) statusLocked() string {
+	if !isFinishedJobStatus(j.status) && errors.Is(context.Cause(j.ctx), errCancelled) {
+		return jobCancelled
+	}
+	return j.status
+}
+
+// cancel aborts the job. It reports false if the job already completed or
+// failed; cancelling a cancelled job is a no-op.
+func (j *job) cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch status := j.statusLocked(); {
+	case status == jobCancelled:
+		return true
+	case isFinishedJobStatus(status):
+		return false
+	case status == jobQueued:
+		j.finishedAt = time.Now() // the worker will skip it
+	}
+	j.cancelCtx(errCancelled)
+	return true
+}
+
+func (j *job) setProgress(progress int) {
+	j.mu.Lock()
+	j.progress = progress
+	j.mu.Unlock()
+}
+
+func (j *job) finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return isFinishedJobStatus(j.statusLocked())
+}
+
+// MarshalJSON renders the job as returned by GET /v1/jobs/{id}.
+func (j *job) MarshalJSON() ([]byte, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	body := map[string]any{
+		"id":              j.id,
+		"object":          "transcription.job",
+		"status":          j.statusLocked(),
+		"progress":        j.progress,
+		"response_format": j.responseFormat,
+		"created_at":      j.createdAt.Unix(),
+	}
+	if !j.finishedAt.IsZero() {
+		body["finished_at"] = j.finishedAt.Unix()
+	}
+	if j.result != nil {
+		body["result"] = j.result
+	}
+	if j.errMessage != "" {
+		body["error"] = map[string]string{"message": j.errMessage}
+	}
+	return json.Marshal(body)
+}
+
+// addJob registers a job and evicts the oldest finished jobs beyond
+// maxFinishedJobs.
+func (s *Server) addJob(j *job) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	if s.jobs == nil {
+		s.jobs = make(map[string]*job)
+	}
+	s.jobs[j.id] = j
+	s.jobOrder = append(s.jobOrder, j.id)
+
+	finished := 0
+	for _, id := range s.jobOrder {
+		if s.jobs[id].finished() {
+			finished++
+		}
+	}
+	kept := s.jobOrder[:0]
+	for _, id := range s.jobOrder {
+		if finished > maxFinishedJobs && s.jobs[id].finished() {
+			delete(s.jobs, id)
+			finished--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.jobOrder = kept
+}
+
+func (s *Server) removeJob(id string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	delete(s.jobs, id)
+	for i, jid := range s.jobOrder {
+		if jid == id {
+			s.jobOrder = append(s.jobOrder[:i], s.jobOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+func (s *Server) getJob(id string) *job {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	return s.jobs[id]
+}
+
+// handleJobCreate accepts the same multipart form as /v1/audio/transcriptions,
+// queues the transcription and returns 202 with the job ID.
+func (s *Server) handleJobCreate(w http.ResponseWriter, r *http.Request) {
+	if !s.modelLoaded() {
+		writeError(w, http.StatusServiceUnavailable, "no model loaded")
+		return
+	}
+
+	req, ok := s.parseTranscriptionRequest(w, r)
+	if !ok {
+		return
+	}
+	if !s.checkModel(w, req.model) {
+		req.Close()
+		return
+	}
+
+	ctx, cancel := context.WithCancelCause(s.baseCtx)
+	j := &job{
+		id:             newID("job"),
+		ctx:            ctx,
+		cancelCtx:      cancel,
+		status:         jobQueued,
+		createdAt:      time.Now(),
+		responseFormat: req.responseFormat,
+	}
+	t := newTask(ctx, func() { s.runJob(j, req) })
+	t.skipped = func() {
+		req.Close()
+		if errors.Is(context.Cause(ctx), errShuttingDown) {
+			j.fail(errShuttingDown.Error())
+		}
+	}
+
+	s.addJob(j)
+	if result, ok := s.cachedResult(req); ok {
+		// A cached result completes the job without queueing it; only
+		// diarization, if requested, still runs.
+		j.setStatus(jobRunning)
+		go func() {
+			defer req.Close()
+			j.complete(req.responseFormat, result, s.startDiarization(req))
+		}()
+	} else if err := s.enqueue(t); err != nil {
+		s.removeJob(j.id)
+		req.Close()
+		writeError(w, http.StatusTooManyRequests, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(requestIDHeader, j.id)
+	w.Header().Set("Location", "/v1/jobs/"+j.id)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(j)
+}
+
+// handleJobGet reports the status, progress and (once completed) the result
+// of a job.
+func (s *Server) handleJobGet(w http.ResponseWriter, r *http.Request) {
+	j := s.getJob(r.PathValue("id"))
+	if j == nil {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(j)
+}
+
+// runJob executes a queued job on the worker goroutine.
+func (s *Server) runJob(j *job, req *transcriptionRequest) {
+	defer req.Close()
+	j.setStatus(jobRunning)
+
+	diarCh := s.startDiarization(req)
+	result, err := s.transcribeRequest(j.ctx, req, whisper.StreamCallbacks{
+		OnProgress: j.setProgress,
+	})
+	if errors.Is(context.Cause(j.ctx), errCancelled) {
+		j.setStatus(jobCancelled)
+		return
+	}
+	if err != nil {
+		log.Printf("job %s failed: %v", j.id, err)
+		if errors.Is(context.Cause(j.ctx), errShuttingDown) {
+			j.fail(errShuttingDown.Error())
+		} else {
+			j.fail("transcription failed: " + err.Error())
+		}
+		return
+	}
+
+	j.complete(req.responseFormat, result, diarCh)
+}
+
+// complete renders the result of j, once diarization is done, and marks
+// it completed.
+func (j *job) complete(responseFormat string, result whisper.TranscribeResult, diarCh chan diarResult) {
+	rendered := renderResult(responseFormat, result, collectDiarization(diarCh))
+	j.mu.Lock()
+	j.result = rendered
+	j.progress = 100
+	j.mu.Unlock()
+	j.setStatus(jobCompleted)
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// errModelReload is returned when a model that was unloaded for being idle
+// cannot be loaded again.
+type errModelReload struct{ name string }
+
+func (e errModelReload) Error() string { return "failed to reload model " + e.name }
+
+// defaultKeepAlive is the keep-alive of newly loaded models.
+func (s *Server) defaultKeepAlive() time.Duration {
+	if s.KeepAlive <= 0 {
+		return -1
+	}
+	return s.KeepAlive
+}
+
+// touchModel marks m as used now and restarts its idle timer.
+func (s *Server) touchModel(m *model) {
+	m.idleMu.Lock()
+	defer m.idleMu.Unlock()
+	m.lastUsed = time.Now()
+	if m.keepAlive < 0 {
+		if m.idleTimer != nil {
+			m.idleTimer.Stop()
+		}
+		return
+	}
+	if m.idleTimer == nil {
+		m.idleTimer = time.AfterFunc(m.keepAlive, func() { s.unloadIdleModel(m) })
+	} else {
+		m.idleTimer.Reset(m.keepAlive)
+	}
+}
+
+// setKeepAlive changes how long the named model stays loaded when idle and
+// restarts its idle timer with the new value. Unknown names are ignored.
+func (s *Server) setKeepAlive(name string, keepAlive time.Duration) {
+	s.mu.RLock()
+	m, err := s.resolveModelLocked(name)
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+	m.idleMu.Lock()
+	m.keepAlive = keepAlive
+	m.idleMu.Unlock()
+	s.touchModel(m)
+}
+
+// unloadIdleModel frees m's whisper context if it has not been used for its
+// keep-alive. The model stays registered so it can be reloaded. A model in
+// use is left alone; its timer restarts when the transcription finishes.
+func (s *Server) unloadIdleModel(m *model) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ctx == nil || m.retired || m.users > 0 {
+		return
+	}
+	m.idleMu.Lock()
+	idle := m.keepAlive >= 0 && time.Since(m.lastUsed) >= m.keepAlive
+	m.idleMu.Unlock()
+	if !idle {
+		return // used again; the timer was restarted
+	}
+	m.closeContextLocked()
+	log.Printf("unloaded idle model %s", m.name)
+}
+
+// reloadModel loads m again after an idle unload. The model file is read
+// without holding any lock other than m.reloadMu, so other models keep
+// serving meanwhile.
+func (s *Server) reloadModel(m *model) error {
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+	m.mu.Lock()
+	done := m.ctx != nil || m.retired
+	m.mu.Unlock()
+	if done {
+		return nil // reloaded by another request, or removed
+	}
+	ctx, err := whisper.New(m.path, m.gpuDevice, m.noGpu)
+	if err != nil {
+		// The error names the file on disk; keep it in the log.
+		log.Printf("failed to reload model %s: %v", m.name, err)
+		return errModelReload{m.name}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.retired {
+		ctx.Close() // removed while loading
+		return nil
+	}
+	m.ctx = ctx
+	m.loadedAt = time.Now()
+	log.Printf("reloaded model %s", m.name)
+	return nil
+}
+
+// acquireModel resolves the named model and takes a whisper state of it,
+// reloading the model first if it was unloaded for being idle. The state
+// must be returned with m.release.
+func (s *Server) acquireModel(name string) (*model, transcriber, error) {
+	for {
+		s.mu.RLock()
+		m, err := s.resolveModelLocked(name)
+		s.mu.RUnlock()
+		if err != nil {
+			return nil, nil, err
+		}
+		t, err := m.acquire()
+		if !errors.Is(err, errModelUnloaded) {
+			return m, t, err
+		}
+		if err := s.reloadModel(m); err != nil {
+			return nil, nil, err
+		}
+		// Resolve again: the model may have been unloaded or replaced.
+	}
+}
+
+// parseKeepAlive parses a keep_alive value: a Go duration ("5m") or a
+// number of seconds. Negative values keep the model loaded forever, 0
+// unloads it right after the request.
+func parseKeepAlive(v string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration such as \"5m\" or seconds, got %q", v)
+	}
+	return d, nil
+}
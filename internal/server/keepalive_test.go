@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func TestParseKeepAlive(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"5m", 5 * time.Minute},
+		{"30", 30 * time.Second},
+		{"0", 0},
+		{"-1", -time.Second},
+	}
+	for _, tt := range tests {
+		got, err := parseKeepAlive(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("parseKeepAlive(%q) = %v, %v; want %v", tt.input, got, err, tt.want)
+		}
+	}
+	if _, err := parseKeepAlive("soon"); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
+
+func TestIdleModelUnloadAndReload(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	m := s.models["tiny"]
+	m.path = "/nonexistent/tiny.bin"
+
+	s.setKeepAlive("tiny", 0)
+	s.touchModel(m)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if loaded, _ := m.loadState(); !loaded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("model was not unloaded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The model stays registered and is reloaded on the next use; the reload
+	// fails here, without naming the file.
+	if !s.modelLoaded() {
+		t.Error("idle model should stay registered")
+	}
+	_, err := s.transcribe(context.Background(), "tiny", make([]float32, 16000), whisper.TranscribeOptions{}, whisper.StreamCallbacks{})
+	var reloadErr errModelReload
+	if !errors.As(err, &reloadErr) {
+		t.Fatalf("err = %v, want errModelReload", err)
+	}
+}
+
+func TestKeepAliveForever(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	m := s.models["tiny"]
+	s.setKeepAlive("tiny", 50*time.Millisecond)
+	s.touchModel(m)
+	s.setKeepAlive("tiny", -1)
+	s.touchModel(m) // stops the timer
+
+	time.Sleep(100 * time.Millisecond)
+	if loaded, _ := m.loadState(); !loaded {
+		t.Error("model was unloaded despite negative keep-alive")
+	}
+}
+
+func TestIdleUnloadSkipsModelInUse(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	m, st, err := s.acquireModel("tiny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.keepAlive = 0
+	s.unloadIdleModel(m) // must neither block nor free the context
+	if loaded, _ := m.loadState(); !loaded {
+		t.Fatal("model in use was unloaded")
+	}
+	m.release(st)
+	s.unloadIdleModel(m)
+	if loaded, _ := m.loadState(); loaded {
+		t.Error("idle model was not unloaded after release")
+	}
+}
+
+func TestKeepAliveNotAppliedOnRejectedRequest(t *testing.T) {
+	s := New(false)
+	s.AllowedDirs = []string{t.TempDir()}
+	addFakeModel(s, "tiny")
+	m := s.models["tiny"]
+	m.keepAlive = time.Hour
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "audio.wav")
+	fw.Write([]byte("not audio"))
+	mw.WriteField("keep_alive", "0")
+	mw.WriteField("diarize_model", "/etc/passwd")
+	mw.Close()
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if m.keepAlive != time.Hour {
+		t.Errorf("keep-alive = %v after a rejected request, want 1h", m.keepAlive)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"cmp"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// defaultLanguageTopK is how many languages POST /v1/audio/language returns
+// unless top_k is set.
+const defaultLanguageTopK = 5
+
+// maxLanguageSeconds is the most audio language detection looks at.
+const maxLanguageSeconds = whisper.LanguageDetectWindow / whisper.SampleRate
+
+// handleLanguageDetect identifies the spoken language from the first
+// seconds of an upload, without transcribing it.
+func (s *Server) handleLanguageDetect(w http.ResponseWriter, r *http.Request) {
+	if !s.modelLoaded() {
+		writeError(w, http.StatusServiceUnavailable, "no model loaded")
+		return
+	}
+
+	ctx, _, stop := s.startRequest(w, r)
+	defer stop()
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeInvalidParam(w, &invalidParamError{param: "file", message: "missing or invalid 'file' field: " + err.Error()})
+		return
+	}
+	defer file.Close()
+
+	f := &formReader{r: r}
+	modelName := r.FormValue("model")
+	topK := cmp.Or(f.int("top_k", 1, math.MaxInt32), defaultLanguageTopK)
+	seconds := cmp.Or(f.float("duration", 1, maxLanguageSeconds), maxLanguageSeconds)
+	threads := f.int("n_threads", 1, runtime.NumCPU())
+	if f.err != nil {
+		writeInvalidParam(w, f.err)
+		return
+	}
+	if !s.checkModel(w, modelName) {
+		return
+	}
+
+	samples, err := audio.ReadWithOptions(file, audio.ReadOptions{Sandbox: &s.FFmpegSandbox})
+	if err != nil {
+		log.Printf("failed to decode audio: %v", err)
+		writeAudioError(w, "invalid audio file", err)
+		return
+	}
+	if len(samples) == 0 {
+		writeInvalidParam(w, &invalidParamError{param: "file", message: "invalid 'file': audio contains no samples"})
+		return
+	}
+	samples = samples[:min(len(samples), int(seconds*whisper.SampleRate))]
+
+	var langs []whisper.LanguageProb
+	if qErr := s.submit(ctx, func() {
+		langs, err = s.detectLanguage(modelName, samples, threads)
+	}); qErr != nil {
+		writeError(w, http.StatusTooManyRequests, qErr.Error())
+		return
+	}
+	if reason := abortReason(ctx); reason != nil {
+		writeAbortError(w, reason)
+		return
+	}
+	if ctx.Err() != nil {
+		return // client gone, nothing to write
+	}
+	if writeModelError(w, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "language detection failed: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buildLanguageResponse(langs, topK))
+}
+
+// buildLanguageResponse renders the topK most likely languages.
+func buildLanguageResponse(langs []whisper.LanguageProb, topK int) map[string]any {
+	langs = langs[:min(len(langs), topK)]
+	list := make([]map[string]any, len(langs))
+	for i, l := range langs {
+		list[i] = map[string]any{
+			"language":    l.Code,
+			"name":        l.Name,
+			"probability": l.Probability,
+		}
+	}
+	resp := map[string]any{"languages": list}
+	if len(langs) > 0 {
+		resp["language"] = langs[0].Code
+		resp["probability"] = langs[0].Probability
+	}
+	return resp
+}
+
+// detectLanguage runs language detection on the named model, reloading it
+// if it was unloaded for being idle. Like transcribe it runs on a queue
+// worker, on a whisper state of its own.
+func (s *Server) detectLanguage(modelName string, samples []float32, threads int) ([]whisper.LanguageProb, error) {
+	m, st, err := s.acquireModel(modelName)
+	if err != nil {
+		return nil, err
+	}
+	defer s.touchModel(m)
+	defer m.release(st)
+	return st.DetectLanguage(samples, s.jobThreads(threads))
+}
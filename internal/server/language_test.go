@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func TestBuildLanguageResponse(t *testing.T) {
+	langs := []whisper.LanguageProb{
+		{Code: "he", Name: "hebrew", Probability: 0.9},
+		{Code: "en", Name: "english", Probability: 0.08},
+		{Code: "ar", Name: "arabic", Probability: 0.02},
+	}
+	data, _ := json.Marshal(buildLanguageResponse(langs, 2))
+	want := `{"language":"he","languages":[{"language":"he","name":"hebrew","probability":0.9},{"language":"en","name":"english","probability":0.08}],"probability":0.9}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+}
+
+func TestLanguageDetectNoModel(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("POST", "/v1/audio/language", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestLanguageDetectInvalidParam(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "audio.wav")
+	fw.Write([]byte("not audio"))
+	mw.WriteField("duration", "45")
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/v1/audio/language", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	var resp struct {
+		Error struct {
+			Param string `json:"param"`
+		} `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Error.Param != "duration" {
+		t.Errorf("param = %q, want duration", resp.Error.Param)
+	}
+}
+
+func TestLanguageDetectEmptyAudio(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, uploadRequest("/v1/audio/language", nativeWav(0), nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"param":"file"`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
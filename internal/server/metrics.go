@@ -0,0 +1,273 @@
+package server
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	durationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+	rtfBuckets      = []float64{0.05, 0.1, 0.25, 0.5, 0.75, 1, 1.5, 2, 5}
+)
+
+// histogram is a Prometheus histogram with fixed upper bounds.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	if i, _ := slices.BinarySearch(h.bounds, v); i < len(h.bounds) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// requestKey labels an HTTP request counter.
+type requestKey struct {
+	method string
+	route  string
+	status int
+}
+
+// metrics collects the counters exposed on /metrics.
+type metrics struct {
+	mu                   sync.Mutex
+	requests             map[requestKey]uint64
+	queueRejections      uint64
+	transcriptionSeconds *histogram
+	realtimeFactor       *histogram
+	audioSeconds         float64
+	conversionSeconds    *histogram
+	conversionFailures   uint64
+	diarizationSeconds   *histogram
+	diarizationFailures  uint64
+	cacheHits            uint64
+	cacheMisses          uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:             make(map[requestKey]uint64),
+		transcriptionSeconds: newHistogram(durationBuckets),
+		realtimeFactor:       newHistogram(rtfBuckets),
+		conversionSeconds:    newHistogram(durationBuckets),
+		diarizationSeconds:   newHistogram(durationBuckets),
+	}
+}
+
+func (m *metrics) observeRequest(method, route string, status int) {
+	m.mu.Lock()
+	m.requests[requestKey{method, route, status}]++
+	m.mu.Unlock()
+}
+
+func (m *metrics) observeQueueRejection() {
+	m.mu.Lock()
+	m.queueRejections++
+	m.mu.Unlock()
+}
+
+// observeTranscription records a finished inference run over audioSeconds
+// of audio.
+func (m *metrics) observeTranscription(elapsed time.Duration, audioSeconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transcriptionSeconds.observe(elapsed.Seconds())
+	m.audioSeconds += audioSeconds
+	if audioSeconds > 0 {
+		m.realtimeFactor.observe(elapsed.Seconds() / audioSeconds)
+	}
+}
+
+func (m *metrics) observeCacheLookup(hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.cacheHits++
+	} else {
+		m.cacheMisses++
+	}
+}
+
+func (m *metrics) observeDiarization(elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.diarizationSeconds.observe(elapsed.Seconds())
+	if err != nil {
+		m.diarizationFailures++
+	}
+}
+
+// ObserveConversion records an ffmpeg conversion. It is meant to be passed
+// to audio.SetConvertHook.
+func (s *Server) ObserveConversion(elapsed time.Duration, err error) {
+	m := s.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conversionSeconds.observe(elapsed.Seconds())
+	if err != nil {
+		m.conversionFailures++
+	}
+}
+
+// statusRecorder captures the response status for request metrics. It
+// passes through Flush for streaming and Hijack for WebSockets.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijacking not supported")
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// countRequests records every request handled by next by method, route
+// pattern and status. Routes come from mux, so requests rejected before
+// reaching it (e.g. 401) are still labelled with their route.
+func (s *Server) countRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if _, pattern := mux.Handler(r); pattern != "" {
+			// Patterns look like "POST /v1/models/load"; keep the path.
+			route = pattern
+			if _, path, ok := strings.Cut(pattern, " "); ok {
+				route = path
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		s.metrics.observeRequest(r.Method, route, rec.status)
+	})
+}
+
+// handleMetrics writes all metrics in the Prometheus text format.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	m := s.metrics
+
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b requestKey) int {
+		return cmp.Or(cmp.Compare(a.route, b.route), cmp.Compare(a.method, b.method), cmp.Compare(a.status, b.status))
+	})
+	writeHelp(&b, "sona_http_requests_total", "counter", "HTTP requests by method, route and status.")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "sona_http_requests_total{method=\"%s\",route=\"%s\",status=\"%d\"} %d\n", labelEscaper.Replace(k.method), labelEscaper.Replace(k.route), k.status, m.requests[k])
+	}
+	writeHelp(&b, "sona_queue_rejections_total", "counter", "Requests rejected with 429 because the queue was full.")
+	fmt.Fprintf(&b, "sona_queue_rejections_total %d\n", m.queueRejections)
+	writeHistogram(&b, "sona_transcription_duration_seconds", "Inference time per transcription.", m.transcriptionSeconds)
+	writeHistogram(&b, "sona_transcription_realtime_factor", "Inference time divided by audio duration.", m.realtimeFactor)
+	writeHelp(&b, "sona_audio_seconds_total", "counter", "Seconds of audio transcribed.")
+	fmt.Fprintf(&b, "sona_audio_seconds_total %s\n", formatFloat(m.audioSeconds))
+	writeHistogram(&b, "sona_ffmpeg_conversion_duration_seconds", "Time spent converting audio with ffmpeg.", m.conversionSeconds)
+	writeHelp(&b, "sona_ffmpeg_conversion_failures_total", "counter", "Failed ffmpeg conversions.")
+	fmt.Fprintf(&b, "sona_ffmpeg_conversion_failures_total %d\n", m.conversionFailures)
+	writeHistogram(&b, "sona_diarization_duration_seconds", "Time spent in speaker diarization.", m.diarizationSeconds)
+	writeHelp(&b, "sona_diarization_failures_total", "counter", "Failed diarization runs.")
+	fmt.Fprintf(&b, "sona_diarization_failures_total %d\n", m.diarizationFailures)
+	writeHelp(&b, "sona_cache_hits_total", "counter", "Transcriptions served from the result cache.")
+	fmt.Fprintf(&b, "sona_cache_hits_total %d\n", m.cacheHits)
+	writeHelp(&b, "sona_cache_misses_total", "counter", "Cacheable transcriptions not found in the result cache.")
+	fmt.Fprintf(&b, "sona_cache_misses_total %d\n", m.cacheMisses)
+	m.mu.Unlock()
+
+	s.mu.RLock()
+	loaded := 0
+	for _, m := range s.models {
+		if ok, _ := m.loadState(); ok {
+			loaded++
+		}
+	}
+	writeHelp(&b, "sona_models_loaded", "gauge", "Number of models in memory.")
+	fmt.Fprintf(&b, "sona_models_loaded %d\n", loaded)
+	writeHelp(&b, "sona_model_loaded", "gauge", "1 for each model in memory, 0 for models unloaded while idle.")
+	for _, name := range s.modelOrder {
+		v := 0
+		if ok, _ := s.models[name].loadState(); ok {
+			v = 1
+		}
+		fmt.Fprintf(&b, "sona_model_loaded{model=\"%s\"} %d\n", labelEscaper.Replace(name), v)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+// labelEscaper escapes label values for the Prometheus text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeHelp(b *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeHistogram(b *strings.Builder, name, help string, h *histogram) {
+	writeHelp(b, name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", name, formatFloat(bound), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n", name, formatFloat(h.sum))
+	fmt.Fprintf(b, "%s_count %d\n", name, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
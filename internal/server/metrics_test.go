@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func scrape(t *testing.T, s *Server) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 200 {
+		t.Fatalf("GET /metrics = %d", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestMetricsRequests(t *testing.T) {
+	s := New(false)
+	h := s.Handler()
+	for _, path := range []string{"/health", "/health", "/v1/jobs/job_x", "/nope"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	body := scrape(t, s)
+	for _, want := range []string{
+		`sona_http_requests_total{method="GET",route="/health",status="200"} 2`,
+		`sona_http_requests_total{method="GET",route="/v1/jobs/{id}",status="404"} 1`,
+		`sona_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsUnauthorizedRoute(t *testing.T) {
+	s := New(false)
+	s.APIKeys = []string{"sk-test"}
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/v1/models", nil))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer sk-test")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if want := `route="/v1/models",status="401"} 1`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("missing %s in:\n%s", want, w.Body.String())
+	}
+}
+
+func TestMetricsObservations(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	s.metrics.observeTranscription(2*time.Second, 10)
+	s.metrics.observeQueueRejection()
+	s.metrics.observeDiarization(time.Second, errNoModel)
+	s.ObserveConversion(300*time.Millisecond, nil)
+
+	body := scrape(t, s)
+	for _, want := range []string{
+		`sona_transcription_duration_seconds_bucket{le="1"} 0`,
+		`sona_transcription_duration_seconds_bucket{le="2.5"} 1`,
+		`sona_transcription_duration_seconds_bucket{le="+Inf"} 1`,
+		`sona_transcription_realtime_factor_sum 0.2`,
+		`sona_audio_seconds_total 10`,
+		`sona_queue_rejections_total 1`,
+		`sona_diarization_failures_total 1`,
+		`sona_ffmpeg_conversion_duration_seconds_count 1`,
+		`sona_models_loaded 1`,
+		`sona_model_loaded{model="tiny"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %s in:\n%s", want, body)
+		}
+	}
+}
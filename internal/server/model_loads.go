@@ -0,0 +1,144 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxFinishedLoads bounds how many finished model loads are kept for polling.
+const maxFinishedLoads = 20
+
+const (
+	loadLoading = "loading"
+	loadLoaded  = "loaded"
+	loadFailed  = "failed"
+)
+
+// modelLoad tracks a model loading in the background, started with
+// POST /v1/models/load and {"async": true}.
+type modelLoad struct {
+	mu         sync.Mutex
+	id         string
+	model      string
+	status     string
+	progress   int // percentage of the model file read
+	createdAt  time.Time
+	finishedAt time.Time
+	errMessage string
+}
+
+func (l *modelLoad) setProgress(progress int) {
+	l.mu.Lock()
+	l.progress = progress
+	l.mu.Unlock()
+}
+
+func (l *modelLoad) finish(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.finishedAt = time.Now()
+	if err != nil {
+		l.status = loadFailed
+		l.errMessage = "failed to load model " + l.model
+		return
+	}
+	l.status = loadLoaded
+	l.progress = 100
+}
+
+func (l *modelLoad) MarshalJSON() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := map[string]any{
+		"id":         l.id,
+		"object":     "model.load",
+		"model":      l.model,
+		"status":     l.status,
+		"progress":   l.progress,
+		"created_at": l.createdAt.Unix(),
+	}
+	if l.errMessage != "" {
+		out["error"] = map[string]string{"message": l.errMessage}
+	}
+	return json.Marshal(out)
+}
+
+// startModelLoad loads a model in the background. The current model of the
+// same name, if any, keeps serving until the new one is swapped in.
+func (s *Server) startModelLoad(name, path string, gpuDevice int, noGpu bool) *modelLoad {
+	l := &modelLoad{
+		id:        newID("load"),
+		model:     name,
+		status:    loadLoading,
+		createdAt: time.Now(),
+	}
+	s.addLoad(l)
+	go func() {
+		_, err := s.loadModel(name, path, gpuDevice, noGpu, l.setProgress)
+		if err != nil {
+			// The error names the file on disk; keep it in the log.
+			log.Printf("failed to load model %s: %v", name, err)
+		}
+		l.finish(err)
+	}()
+	return l
+}
+
+// addLoad registers l, dropping the oldest finished loads beyond
+// maxFinishedLoads.
+func (s *Server) addLoad(l *modelLoad) {
+	s.loadsMu.Lock()
+	defer s.loadsMu.Unlock()
+	if s.loads == nil {
+		s.loads = make(map[string]*modelLoad)
+	}
+	s.loads[l.id] = l
+	s.loadOrder = append(s.loadOrder, l.id)
+
+	finished := 0
+	for i := len(s.loadOrder) - 1; i >= 0; i-- {
+		old := s.loads[s.loadOrder[i]]
+		old.mu.Lock()
+		done := old.status != loadLoading
+		old.mu.Unlock()
+		if !done {
+			continue
+		}
+		if finished++; finished > maxFinishedLoads {
+			delete(s.loads, old.id)
+			s.loadOrder = append(s.loadOrder[:i], s.loadOrder[i+1:]...)
+		}
+	}
+}
+
+// loadingModels returns the names of models being loaded in the background.
+func (s *Server) loadingModels() []string {
+	s.loadsMu.Lock()
+	defer s.loadsMu.Unlock()
+	var names []string
+	for _, id := range s.loadOrder {
+		l := s.loads[id]
+		l.mu.Lock()
+		if l.status == loadLoading {
+			names = append(names, l.model)
+		}
+		l.mu.Unlock()
+	}
+	return names
+}
+
+// handleModelLoadGet reports the status and progress of a background load.
+func (s *Server) handleModelLoadGet(w http.ResponseWriter, r *http.Request) {
+	s.loadsMu.Lock()
+	l, ok := s.loads[r.PathValue("id")]
+	s.loadsMu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "model load not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func TestFailedLoadKeepsModel(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny.bin")
+	old := s.models["tiny.bin"]
+
+	if _, err := s.LoadModel("tiny.bin", "/nonexistent/tiny.bin", -1, false); err == nil {
+		t.Fatal("expected load error")
+	}
+	if s.models["tiny.bin"] != old || old.ctx == nil {
+		t.Error("failed load replaced the loaded model")
+	}
+}
+
+func TestAddModelReplacesInPlace(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "a")
+	addFakeModel(s, "b")
+	old := s.models["a"]
+
+	s.addModelLocked(&model{name: "a", ctx: &whisper.Context{}, keepAlive: -1})
+	if !slices.Equal(s.modelOrder, []string{"a", "b"}) {
+		t.Errorf("order = %v, want [a b]", s.modelOrder)
+	}
+	if s.models["a"] == old || old.ctx != nil {
+		t.Error("old model was not replaced and freed")
+	}
+}
+
+func TestReplaceModelInUse(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "a")
+	old, st, err := s.acquireModel("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	swapped := make(chan struct{})
+	go func() {
+		s.mu.Lock()
+		s.addModelLocked(&model{name: "a", ctx: &whisper.Context{}, keepAlive: -1})
+		s.mu.Unlock()
+		close(swapped)
+	}()
+	select {
+	case <-swapped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("swap waited for a running transcription")
+	}
+	if loaded, _ := old.loadState(); !loaded {
+		t.Fatal("replaced model was freed while in use")
+	}
+	old.release(st)
+	if loaded, _ := old.loadState(); loaded {
+		t.Error("replaced model was not freed by its last user")
+	}
+}
+
+func TestAsyncModelLoad(t *testing.T) {
+	s := New(false)
+	path := filepath.Join(t.TempDir(), "broken.bin")
+	os.WriteFile(path, nil, 0o644)
+
+	w := httptest.NewRecorder()
+	body := `{"path":"` + filepath.ToSlash(path) + `","async":true}`
+	s.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/v1/models/load", strings.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	location := w.Header().Get("Location")
+	if !regexp.MustCompile(`^/v1/models/load/load_[0-9a-f]{16}$`).MatchString(location) {
+		t.Fatalf("Location = %q", location)
+	}
+
+	var load struct {
+		Status string `json:"status"`
+		Model  string `json:"model"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for load.Status != loadFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("load did not fail, status %q", load.Status)
+		}
+		w = httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("GET", location, nil))
+		json.Unmarshal(w.Body.Bytes(), &load)
+		time.Sleep(5 * time.Millisecond)
+	}
+	if load.Model != "broken.bin" || load.Error == nil || strings.Contains(load.Error.Message, path) {
+		t.Errorf("load = %+v", load)
+	}
+}
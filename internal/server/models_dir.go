@@ -0,0 +1,63 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// modelFileExt is the extension of ggml model files picked up from ModelsDir.
+const modelFileExt = ".bin"
+
+// modelFile is a model file on disk. Its ID is the file name, the same name
+// LoadModel registers a model under by default.
+type modelFile struct {
+	id      string
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// scanModelsDir lists the model files in ModelsDir, sorted by ID. It returns
+// nothing when no models directory is configured.
+func (s *Server) scanModelsDir() ([]modelFile, error) {
+	if s.ModelsDir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.ModelsDir)
+	if err != nil {
+		return nil, err
+	}
+	var files []modelFile
+	for _, e := range entries {
+		if !strings.EqualFold(filepath.Ext(e.Name()), modelFileExt) {
+			continue
+		}
+		path := filepath.Join(s.ModelsDir, e.Name())
+		info, err := os.Stat(path) // follows symlinks
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, modelFile{id: e.Name(), path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+	slices.SortFunc(files, func(a, b modelFile) int { return strings.Compare(a.id, b.id) })
+	return files, nil
+}
+
+// findModelFile returns the path of the model file with the given ID in
+// ModelsDir.
+func (s *Server) findModelFile(id string) (string, error) {
+	files, err := s.scanModelsDir()
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if f.id == id {
+			return f.path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", errModelNotFound, id)
+}
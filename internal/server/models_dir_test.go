@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newModelsDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "ggml-tiny.bin"), []byte("tiny"), 0o644)
+	os.WriteFile(filepath.Join(dir, "ggml-base.bin"), []byte("base model"), 0o644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o644)
+	os.Mkdir(filepath.Join(dir, "dir.bin"), 0o755)
+	return dir
+}
+
+func TestScanModelsDir(t *testing.T) {
+	s := New(false)
+	s.ModelsDir = newModelsDir(t)
+
+	files, err := s.scanModelsDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0].id != "ggml-base.bin" || files[1].id != "ggml-tiny.bin" {
+		t.Fatalf("files = %+v", files)
+	}
+	if files[0].size != int64(len("base model")) {
+		t.Errorf("size = %d", files[0].size)
+	}
+	if _, err := s.findModelFile("notes.txt"); err == nil {
+		t.Error("non-model file should not be found")
+	}
+}
+
+func TestModelsListsModelsDir(t *testing.T) {
+	s := New(false)
+	s.ModelsDir = newModelsDir(t)
+	addFakeModel(s, "ggml-tiny.bin")
+	s.models["ggml-tiny.bin"].path = filepath.Join(s.ModelsDir, "ggml-tiny.bin")
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+
+	var resp struct {
+		Data []struct {
+			ID     string `json:"id"`
+			Loaded bool   `json:"loaded"`
+			Size   int64  `json:"size"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if len(resp.Data) != 2 {
+		t.Fatalf("got %d models, want 2: %s", len(resp.Data), w.Body.String())
+	}
+	if m := resp.Data[0]; m.ID != "ggml-tiny.bin" || !m.Loaded || m.Size != 4 {
+		t.Errorf("data[0] = %+v", m)
+	}
+	if m := resp.Data[1]; m.ID != "ggml-base.bin" || m.Loaded {
+		t.Errorf("data[1] = %+v", m)
+	}
+}
+
+func TestModelLoadByID(t *testing.T) {
+	s := New(false)
+	load := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/v1/models/load", strings.NewReader(`{"id":"ggml-large.bin"}`))
+		s.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := load(); w.Code != http.StatusBadRequest {
+		t.Errorf("without models dir: expected 400, got %d", w.Code)
+	}
+	s.ModelsDir = newModelsDir(t)
+	if w := load(); w.Code != http.StatusNotFound {
+		t.Errorf("unknown id: expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// errPathNotAllowed is returned for client-supplied paths that do not exist
+// or resolve outside the allowed directories. It deliberately does not say
+// which, nor echo the resolved path, so clients cannot probe the filesystem.
+var errPathNotAllowed = errors.New("file not found or not in an allowed directory")
+
+// allowedRoots returns the canonical allowed directories: AllowedDirs and
+// ModelsDir. Directories that cannot be resolved are skipped. An empty
+// result means paths are not restricted.
+func (s *Server) allowedRoots() (roots []string, restricted bool) {
+	dirs := s.AllowedDirs
+	if s.ModelsDir != "" {
+		dirs = append(dirs[:len(dirs):len(dirs)], s.ModelsDir)
+	}
+	for _, dir := range dirs {
+		if root, err := canonicalPath(dir); err == nil {
+			roots = append(roots, root)
+		}
+	}
+	return roots, len(dirs) > 0
+}
+
+// resolveClientPath canonicalizes a client-supplied file path, following
+// symlinks, and checks that the result lies inside an allowed directory.
+// Without configured directories any existing path is accepted.
+func (s *Server) resolveClientPath(path string) (string, error) {
+	resolved, err := canonicalPath(path)
+	if err != nil {
+		return "", errPathNotAllowed
+	}
+	roots, restricted := s.allowedRoots()
+	if !restricted {
+		return resolved, nil
+	}
+	for _, root := range roots {
+		if isWithin(root, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", errPathNotAllowed
+}
+
+// canonicalPath returns the absolute path with all symlinks resolved. The
+// path must exist.
+func canonicalPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// isWithin reports whether path is root or below it. Both must be canonical.
+func isWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveClientPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(root, "model.bin"), nil, 0o644)
+	os.WriteFile(filepath.Join(outside, "secret.bin"), nil, 0o644)
+	if err := os.Symlink(filepath.Join(outside, "secret.bin"), filepath.Join(root, "link.bin")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	s := New(false)
+	s.AllowedDirs = []string{root}
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{filepath.Join(root, "model.bin"), true},
+		{filepath.Join(root, "missing.bin"), false},
+		{filepath.Join(outside, "secret.bin"), false},
+		{filepath.Join(root, "..", filepath.Base(outside), "secret.bin"), false},
+		{filepath.Join(root, "link.bin"), false},
+	}
+	for _, tt := range tests {
+		_, err := s.resolveClientPath(tt.path)
+		if (err == nil) != tt.ok {
+			t.Errorf("resolveClientPath(%s) err = %v, want ok %v", tt.path, err, tt.ok)
+		}
+		if err != nil && strings.Contains(err.Error(), root) {
+			t.Errorf("error leaks path: %v", err)
+		}
+	}
+
+	// Without allowed directories any existing file is accepted.
+	s.AllowedDirs = nil
+	if _, err := s.resolveClientPath(filepath.Join(outside, "secret.bin")); err != nil {
+		t.Errorf("unrestricted: %v", err)
+	}
+}
+
+func TestModelLoadOutsideAllowedDirs(t *testing.T) {
+	s := New(false)
+	s.AllowedDirs = []string{t.TempDir()}
+	outside := filepath.Join(t.TempDir(), "model.bin")
+	os.WriteFile(outside, nil, 0o644)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/v1/models/load", strings.NewReader(`{"path":"`+filepath.ToSlash(outside)+`"}`))
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), filepath.Dir(outside)) {
+		t.Errorf("response leaks path: %s", w.Body.String())
+	}
+}
+
+func TestDiarizeModelOutsideAllowedDirs(t *testing.T) {
+	s := New(false)
+	s.AllowedDirs = []string{t.TempDir()}
+	addFakeModel(s, "tiny")
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "audio.wav")
+	fw.Write([]byte("not audio"))
+	mw.WriteField("diarize_model", "/etc/passwd")
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"param":"diarize_model"`) {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultQueueDepth = 8
+
+// errQueueFull is returned when no queue slot is free for a new task.
+var errQueueFull = errors.New("transcription queue is full")
+
+// task is a unit of inference work executed by the queue worker.
+type task struct {
+	ctx     context.Context // task is skipped if ctx ends while queued
+	run     func()
+	skipped func() // optional, called instead of run when the task is skipped
+	done    chan struct{}
+}
+
+func newTask(ctx context.Context, run func()) *task {
+	return &task{ctx: ctx, run: run, done: make(chan struct{})}
+}
+
+// enqueue adds a task to the FIFO queue without blocking. It fails with
+// errQueueFull when QueueDepth tasks are already waiting.
+func (s *Server) enqueue(t *task) error {
+	s.queueOnce.Do(s.startQueue)
+	s.pending.Add(1)
+	select {
+	case s.queue <- t:
+		return nil
+	default:
+		s.pending.Add(-1)
+		s.metrics.observeQueueRejection()
+		return errQueueFull
+	}
+}
+
+// submit enqueues run and blocks until it has finished, or until the worker
+// skipped it because ctx ended while it was still waiting.
+func (s *Server) submit(ctx context.Context, run func()) error {
+	t := newTask(ctx, run)
+	if err := s.enqueue(t); err != nil {
+		return err
+	}
+	<-t.done
+	return nil
+}
+
+func (s *Server) startQueue() {
+	depth := s.QueueDepth
+	if depth < 0 {
+		depth = 0
+	}
+	// With depth 0 a send only succeeds while a worker is idle, which
+	// rejects every request that would have to wait.
+	s.queue = make(chan *task, depth)
+	for range max(1, s.Concurrency) {
+		go s.worker()
+	}
+}
+
+// worker runs queued tasks one at a time, in arrival order. With several
+// workers, tasks start in arrival order but may finish in any order.
+func (s *Server) worker() {
+	for t := range s.queue {
+		if t.ctx.Err() == nil {
+			t.run()
+		} else if t.skipped != nil {
+			t.skipped()
+		}
+		close(t.done)
+		s.pending.Add(-1)
+	}
+}
+
+// waitIdle blocks until no task is queued or running, or ctx ends.
+func (s *Server) waitIdle(ctx context.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for s.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
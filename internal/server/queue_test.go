@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestQueueRejectsWhenFull(t *testing.T) {
+	s := New(false)
+	s.QueueDepth = 1
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	running := newTask(context.Background(), func() {
+		close(started)
+		<-release
+	})
+	if err := s.enqueue(running); err != nil {
+		t.Fatalf("enqueue running task: %v", err)
+	}
+	<-started
+
+	waiting := newTask(context.Background(), func() {})
+	if err := s.enqueue(waiting); err != nil {
+		t.Fatalf("enqueue waiting task: %v", err)
+	}
+	if err := s.enqueue(newTask(context.Background(), func() {})); err != errQueueFull {
+		t.Fatalf("expected errQueueFull, got %v", err)
+	}
+
+	close(release)
+	<-waiting.done
+}
+
+func TestQueueFIFO(t *testing.T) {
+	s := New(false)
+
+	release := make(chan struct{})
+	first := newTask(context.Background(), func() { <-release })
+	if err := s.enqueue(first); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	var order []int
+	var tasks []*task
+	for i := 0; i < 3; i++ {
+		tk := newTask(context.Background(), func() { order = append(order, i) })
+		if err := s.enqueue(tk); err != nil {
+			t.Fatalf("enqueue %d: %v", i, err)
+		}
+		tasks = append(tasks, tk)
+	}
+	close(release)
+	<-tasks[len(tasks)-1].done
+
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("tasks ran in order %v, want [0 1 2]", order)
+		}
+	}
+}
+
+func TestQueueRunsConcurrently(t *testing.T) {
+	s := New(false)
+	s.Concurrency = 2
+
+	// Each task waits for the other to start, so they only finish if both
+	// run at once.
+	var started [2]chan struct{}
+	for i := range started {
+		started[i] = make(chan struct{})
+	}
+	var tasks []*task
+	for i := range 2 {
+		tk := newTask(context.Background(), func() {
+			close(started[i])
+			<-started[1-i]
+		})
+		if err := s.enqueue(tk); err != nil {
+			t.Fatalf("enqueue %d: %v", i, err)
+		}
+		tasks = append(tasks, tk)
+	}
+	for _, tk := range tasks {
+		select {
+		case <-tk.done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("tasks did not run concurrently")
+		}
+	}
+}
+
+func TestJobThreads(t *testing.T) {
+	cpus := runtime.NumCPU()
+	tests := []struct {
+		concurrency, perJob, requested, want int
+	}{
+		{1, 0, 0, min(4, cpus)},
+		{1, 0, cpus, cpus},
+		{cpus, 0, 0, 1},
+		{cpus, 0, cpus, 1},
+		{2, 3, 0, 3},
+		{2, 3, 8, 3},
+		{2, 3, 2, 2},
+	}
+	for _, tt := range tests {
+		s := New(false)
+		s.Concurrency = tt.concurrency
+		s.ThreadsPerJob = tt.perJob
+		if got := s.jobThreads(tt.requested); got != tt.want {
+			t.Errorf("concurrency %d, threads per job %d: jobThreads(%d) = %d, want %d", tt.concurrency, tt.perJob, tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestQueueSkipsCancelledTask(t *testing.T) {
+	s := New(false)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ran := false
+	if err := s.submit(ctx, func() { ran = true }); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if ran {
+		t.Error("cancelled task should not run")
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	s := New(false)
+	release := make(chan struct{})
+	if err := s.enqueue(newTask(context.Background(), func() { <-release })); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	j := &job{id: newID("job"), ctx: ctx, cancelCtx: cancel, status: jobQueued}
+	ran, skipped := false, false
+	tk := newTask(ctx, func() { ran = true })
+	tk.skipped = func() { skipped = true }
+	if err := s.enqueue(tk); err != nil {
+		t.Fatalf("enqueue job: %v", err)
+	}
+
+	if !j.cancel() {
+		t.Fatal("cancel of queued job reported already finished")
+	}
+	if !j.finished() {
+		t.Error("cancelled job should report finished")
+	}
+	close(release)
+	<-tk.done
+	if ran || !skipped {
+		t.Errorf("ran=%v skipped=%v, want skipped only", ran, skipped)
+	}
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+const (
+	realtimeSampleRate = whisper.SampleRate
+	samplesPerCs       = realtimeSampleRate / 100
+
+	// realtimeStep is how much new audio triggers another pass over the window.
+	realtimeStep = 1 * realtimeSampleRate
+	// realtimeMaxWindow bounds the unfinalized audio. Once exceeded, all but
+	// the last segment are finalized even if they have not stabilized.
+	realtimeMaxWindow = 20 * realtimeSampleRate
+	// realtimePromptChars is how much finalized text is passed as the prompt
+	// for the next window.
+	realtimePromptChars = 200
+)
+
+// wsFrame is a received WebSocket message and its frame type.
+type wsFrame struct {
+	data   []byte
+	binary bool
+}
+
+var frameCodec = websocket.Codec{
+	Marshal: websocket.Message.Marshal,
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		f := v.(*wsFrame)
+		f.data = data
+		f.binary = payloadType == websocket.BinaryFrame
+		return nil
+	},
+}
+
+// realtimeWindow holds the audio that is not finalized yet and the previous
+// hypothesis for it. Finalized text leaves the window, so each pass
+// re-transcribes everything after the last finalized segment: consecutive
+// windows overlap on the unstable tail.
+type realtimeWindow struct {
+	samples []float32         // unfinalized audio
+	offset  int64             // absolute position of samples[0], in samples
+	pending int               // samples received since the last pass
+	prev    []whisper.Segment // previous hypothesis, absolute times
+	final   strings.Builder   // all finalized text
+}
+
+func (rw *realtimeWindow) append(samples []float32) {
+	rw.samples = append(rw.samples, samples...)
+	rw.pending += len(samples)
+}
+
+// prompt returns the tail of the finalized text, starting on a rune
+// boundary.
+func (rw *realtimeWindow) prompt() string {
+	text := rw.final.String()
+	if len(text) > realtimePromptChars {
+		start := len(text) - realtimePromptChars
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+		text = text[start:]
+	}
+	return strings.TrimSpace(text)
+}
+
+// skip records a pass that could not run because the queue was full. The
+// next pass waits for another step of audio, and audio beyond
+// realtimeMaxWindow is dropped, oldest first, so a session under sustained
+// load loses audio instead of buffering it without bound.
+func (rw *realtimeWindow) skip() {
+	rw.pending = 0
+	if excess := len(rw.samples) - realtimeMaxWindow; excess > 0 {
+		rw.trim(int64(excess))
+		rw.prev = nil // no longer lines up with the window
+	}
+}
+
+// update merges a hypothesis for the current window, whose times are
+// relative to the window start. A segment is finalized once it matches the
+// previous hypothesis, except for the last one, which may still be cut off
+// by the window end. With flush set, every segment is finalized. It returns
+// the newly finalized segments and the remaining partial ones, both with
+// absolute times.
+func (rw *realtimeWindow) update(hyp []whisper.Segment, flush bool) (final, partial []whisper.Segment) {
+	base := rw.offset / samplesPerCs
+	abs := make([]whisper.Segment, len(hyp))
+	for i, seg := range hyp {
+		seg.Start += base
+		seg.End += base
+		abs[i] = seg
+	}
+
+	n := 0 // number of segments to finalize
+	switch {
+	case flush:
+		n = len(abs)
+	case len(rw.samples) > realtimeMaxWindow:
+		n = max(len(abs)-1, min(len(abs), 1))
+	default:
+		for n < len(abs)-1 && n < len(rw.prev) && strings.TrimSpace(abs[n].Text) == strings.TrimSpace(rw.prev[n].Text) {
+			n++
+		}
+	}
+
+	final, partial = abs[:n], abs[n:]
+	for _, seg := range final {
+		rw.final.WriteString(seg.Text)
+	}
+	rw.prev = partial
+	rw.pending = 0
+
+	switch {
+	case n > 0:
+		rw.trim(final[n-1].End*samplesPerCs - rw.offset)
+	case len(abs) == 0 && len(rw.samples) > realtimeMaxWindow:
+		// Nothing but silence or noise: keep only the most recent audio.
+		rw.trim(int64(len(rw.samples) - realtimeStep))
+	}
+	return final, partial
+}
+
+// trim drops n samples from the start of the window.
+func (rw *realtimeWindow) trim(n int64) {
+	n = min(max(n, 0), int64(len(rw.samples)))
+	rw.samples = rw.samples[n:]
+	rw.offset += n
+}
+
+// pcm16ToFloat32 decodes little-endian signed 16-bit PCM. An odd trailing
+// byte is returned so it can be prepended to the next frame.
+func pcm16ToFloat32(data []byte) ([]float32, []byte) {
+	n := len(data) / 2
+	out := make([]float32, n)
+	for i := 0; i < n; i++ {
+		out[i] = float32(int16(binary.LittleEndian.Uint16(data[2*i:]))) / math.MaxInt16
+	}
+	return out, data[2*n:]
+}
+
+// handleRealtime upgrades to a WebSocket that accepts raw 16 kHz mono 16-bit
+// little-endian PCM in binary frames and sends back partial and final
+// segments as text frames. A {"type":"stop"} text frame finalizes the
+// remaining audio and ends the session with a "done" event. Query
+// parameters: model, language, keep_alive.
+func (s *Server) handleRealtime(w http.ResponseWriter, r *http.Request) {
+	f := &formReader{r: r}
+	language := f.language("language")
+	keepAlive, setKeepAlive := f.keepAlive("keep_alive")
+	if f.err != nil {
+		writeInvalidParam(w, f.err)
+		return
+	}
+	model := r.FormValue("model")
+	if !s.checkModel(w, model) {
+		return
+	}
+	if setKeepAlive {
+		s.setKeepAlive(model, keepAlive)
+	}
+
+	ctx, _, stop := s.startRequest(w, r)
+	defer stop()
+
+	opts := whisper.TranscribeOptions{
+		Language:       language,
+		Verbose:        s.verbose,
+		SamplingGreedy: true,
+	}
+
+	// websocket.Server, unlike websocket.Handler, does not require an Origin
+	// header, so non-browser clients can connect.
+	srv := websocket.Server{
+		Config: websocket.Config{Header: w.Header().Clone()}, // carries X-Request-Id
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.TextFrame
+			// Cancellation by request ID or shutdown unblocks the reader below.
+			defer context.AfterFunc(ctx, func() {
+				if errors.Is(context.Cause(ctx), errShuttingDown) {
+					websocket.JSON.Send(ws, map[string]any{"type": "error", "message": errShuttingDown.Error()})
+				}
+				ws.Close()
+			})()
+
+			frames := make(chan []float32, 64)
+			stopped := false // set when the client sent {"type":"stop"}
+			go func() {
+				defer close(frames)
+				var rest []byte
+				for {
+					var f wsFrame
+					if err := frameCodec.Receive(ws, &f); err != nil {
+						return
+					}
+					if !f.binary {
+						var msg struct {
+							Type string `json:"type"`
+						}
+						if json.Unmarshal(f.data, &msg) == nil && msg.Type == "stop" {
+							stopped = true
+							return
+						}
+						continue
+					}
+					var samples []float32
+					samples, rest = pcm16ToFloat32(append(rest, f.data...))
+					frames <- samples
+				}
+			}()
+
+			// Events are JSON text frames: "partial", "final", "error", "done".
+			send := func(event map[string]any) bool {
+				return websocket.JSON.Send(ws, event) == nil
+			}
+			sendError := func(message string) bool {
+				return send(map[string]any{"type": "error", "message": message})
+			}
+			sendSegment := func(typ string, segs []whisper.Segment) bool {
+				event := map[string]any{
+					"type":  typ,
+					"start": 0.0,
+					"end":   0.0,
+					"text":  whisper.TranscribeResult{Segments: segs}.Text(),
+				}
+				if len(segs) > 0 {
+					event["start"] = csToSeconds(segs[0].Start)
+					event["end"] = csToSeconds(segs[len(segs)-1].End)
+				}
+				return send(event)
+			}
+
+			var rw realtimeWindow
+			pass := func(flush bool) bool {
+				if len(rw.samples) < realtimeSampleRate {
+					return true // whisper.cpp ignores input shorter than 1s
+				}
+				passOpts := opts
+				passOpts.Prompt = rw.prompt()
+				var result whisper.TranscribeResult
+				var err error
+				if qErr := s.submit(ctx, func() {
+					result, err = s.transcribe(ctx, model, rw.samples, passOpts, whisper.StreamCallbacks{})
+				}); qErr != nil {
+					// Queue full: retry on the next step, unless this is the last pass.
+					rw.skip()
+					return !flush || sendError(qErr.Error())
+				}
+				if ctx.Err() != nil {
+					return false
+				}
+				if err != nil {
+					sendError(err.Error())
+					return false
+				}
+
+				final, partial := rw.update(result.Segments, flush)
+				for _, seg := range final {
+					if !sendSegment("final", []whisper.Segment{seg}) {
+						return false
+					}
+				}
+				return flush || sendSegment("partial", partial)
+			}
+
+			for samples := range frames {
+				rw.append(samples)
+				if rw.pending >= realtimeStep && !pass(false) {
+					// Let the reader exit; it may be blocked on a full channel.
+					ws.Close()
+					for range frames {
+					}
+					return
+				}
+			}
+			if !stopped {
+				return // client went away
+			}
+			if pass(true) {
+				send(map[string]any{"type": "done"})
+			}
+		},
+	}
+	srv.ServeHTTP(w, r)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func TestPCM16ToFloat32(t *testing.T) {
+	samples, rest := pcm16ToFloat32([]byte{0xff, 0x7f, 0x01, 0x80, 0x00})
+	if len(samples) != 2 || samples[0] != 1 || samples[1] != -1 {
+		t.Errorf("samples = %v, want [1 -1]", samples)
+	}
+	if len(rest) != 1 {
+		t.Errorf("len(rest) = %d, want 1", len(rest))
+	}
+}
+
+func TestRealtimeWindowFinalizesStableSegments(t *testing.T) {
+	var rw realtimeWindow
+	rw.append(make([]float32, 3*realtimeSampleRate))
+
+	hyp := []whisper.Segment{
+		{Start: 0, End: 100, Text: " Hello"},
+		{Start: 100, End: 250, Text: " wor"},
+	}
+	final, partial := rw.update(hyp, false)
+	if len(final) != 0 || len(partial) != 2 {
+		t.Fatalf("first pass: %d final, %d partial; want 0, 2", len(final), len(partial))
+	}
+
+	hyp = []whisper.Segment{
+		{Start: 0, End: 100, Text: " Hello "},
+		{Start: 100, End: 280, Text: " world"},
+	}
+	final, partial = rw.update(hyp, false)
+	if len(final) != 1 || final[0].Text != " Hello " {
+		t.Fatalf("final = %v, want the first segment", final)
+	}
+	if len(partial) != 1 {
+		t.Fatalf("len(partial) = %d, want 1", len(partial))
+	}
+	if rw.offset != 100*samplesPerCs {
+		t.Errorf("offset = %d, want %d", rw.offset, 100*samplesPerCs)
+	}
+
+	// Times of the next window are relative to the new offset.
+	final, _ = rw.update([]whisper.Segment{{Start: 0, End: 180, Text: " world"}}, true)
+	if len(final) != 1 || final[0].Start != 100 || final[0].End != 280 {
+		t.Fatalf("final = %v, want [100, 280]", final)
+	}
+	if got := rw.prompt(); got != "Hello  world" {
+		t.Errorf("prompt = %q", got)
+	}
+}
+
+func TestRealtimeWindowForcesLongWindow(t *testing.T) {
+	var rw realtimeWindow
+	rw.append(make([]float32, realtimeMaxWindow+realtimeSampleRate))
+
+	hyp := []whisper.Segment{
+		{Start: 0, End: 1000, Text: " one"},
+		{Start: 1000, End: 2000, Text: " two"},
+	}
+	final, partial := rw.update(hyp, false)
+	if len(final) != 1 || len(partial) != 1 {
+		t.Fatalf("%d final, %d partial; want 1, 1", len(final), len(partial))
+	}
+
+	// Silence only: the window is cut down to the last step.
+	rw = realtimeWindow{}
+	rw.append(make([]float32, realtimeMaxWindow+realtimeSampleRate))
+	rw.update(nil, false)
+	if len(rw.samples) != realtimeStep {
+		t.Errorf("len(samples) = %d, want %d", len(rw.samples), realtimeStep)
+	}
+}
+
+func TestRealtimeWindowSkipBoundsMemory(t *testing.T) {
+	var rw realtimeWindow
+	for range 30 {
+		rw.append(make([]float32, realtimeStep))
+		rw.skip() // queue full
+	}
+	if rw.pending != 0 {
+		t.Errorf("pending = %d after a skipped pass, want 0", rw.pending)
+	}
+	if len(rw.samples) != realtimeMaxWindow || rw.offset != 10*realtimeStep {
+		t.Errorf("window holds %d samples from %d, want %d from %d", len(rw.samples), rw.offset, realtimeMaxWindow, 10*realtimeStep)
+	}
+}
+
+func TestRealtimeWindowPromptRuneBoundary(t *testing.T) {
+	var rw realtimeWindow
+	rw.final.WriteString(strings.Repeat("שלום ", 50)) // 9 bytes per word
+	prompt := rw.prompt()
+	if !utf8.ValidString(prompt) || len(prompt) > realtimePromptChars {
+		t.Errorf("prompt %q is not a valid tail of at most %d bytes", prompt, realtimePromptChars)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+)
+
+// requestIDHeader carries the ID that can be passed to
+// DELETE /v1/audio/transcriptions/{request_id} to cancel a transcription.
+const requestIDHeader = "X-Request-Id"
+
+// errCancelled is the context cause for transcriptions cancelled through the API.
+var errCancelled = errors.New("transcription cancelled")
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// newID returns a random identifier such as "req_3f9a1c0d2b7e4a51".
+func newID(prefix string) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return prefix + "_" + hex.EncodeToString(b[:])
+}
+
+// startRequest registers a cancellable transcription and sets the request ID
+// response header. A client-supplied X-Request-Id is reused when it is well
+// formed and not already in use; it is how clients learn the ID of a
+// non-streaming request, whose headers are only sent with the result. The context also ends when the server shuts
+// down. The returned stop func must be called when the request finishes.
+func (s *Server) startRequest(w http.ResponseWriter, r *http.Request) (ctx context.Context, id string, stop func()) {
+	ctx, cancel := context.WithCancelCause(r.Context())
+	stopAbort := context.AfterFunc(s.baseCtx, func() { cancel(context.Cause(s.baseCtx)) })
+
+	s.requestsMu.Lock()
+	if s.requests == nil {
+		s.requests = make(map[string]context.CancelCauseFunc)
+	}
+	id = r.Header.Get(requestIDHeader)
+	if _, taken := s.requests[id]; taken || !validRequestID.MatchString(id) {
+		id = newID("req")
+	}
+	s.requests[id] = cancel
+	s.requestsMu.Unlock()
+
+	w.Header().Set(requestIDHeader, id)
+	return ctx, id, func() {
+		s.requestsMu.Lock()
+		delete(s.requests, id)
+		s.requestsMu.Unlock()
+		stopAbort()
+		cancel(nil)
+	}
+}
+
+// cancelRequest aborts a running or queued synchronous transcription.
+// It reports false if no such request is in flight.
+func (s *Server) cancelRequest(id string) bool {
+	s.requestsMu.Lock()
+	cancel, ok := s.requests[id]
+	s.requestsMu.Unlock()
+	if ok {
+		cancel(errCancelled)
+	}
+	return ok
+}
+
+// handleTranscriptionCancel aborts a transcription or job by ID.
+func (s *Server) handleTranscriptionCancel(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	if j := s.getJob(id); j != nil {
+		if !j.cancel() {
+			writeError(w, http.StatusConflict, "job already finished")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(j)
+		return
+	}
+
+	if !s.cancelRequest(id) {
+		writeError(w, http.StatusNotFound, "no running or queued transcription with this ID")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":     id,
+		"status": "cancelled",
+	})
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
@@ -10,70 +11,257 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/thewh1teagle/sona/internal/audio"
 	"github.com/thewh1teagle/sona/internal/whisper"
 )
 
 const maxUploadSize = 15 << 30 // 15 GB
 
 type Server struct {
-	mu        sync.Mutex
-	ctx       *whisper.Context // nil when no model loaded
-	modelName string
-	modelPath string
-	verbose   bool
-	Version   string
-	Commit    string
+	mu         sync.RWMutex      // guards models and modelOrder; never held during inference
+	models     map[string]*model // loaded models by name
+	modelOrder []string          // load order; the first entry is the default model
+	verbose    bool
+	Version    string
+	Commit     string
+
+	// QueueDepth is the number of transcriptions that may wait while all
+	// workers are busy. Further requests are rejected with 429. Must be set
+	// before the first request is served.
+	QueueDepth int
+	queueOnce  sync.Once
+	queue      chan *task
+	pending    atomic.Int64 // queued and running tasks
+
+	// Concurrency is the number of queue workers, i.e. how many
+	// transcriptions run at once. They share the loaded model, each on its
+	// own whisper state. Must be set before the first request is served.
+	Concurrency int
+	// ThreadsPerJob caps the CPU threads of each transcription (0 = split
+	// the CPUs evenly between the workers).
+	ThreadsPerJob int
+
+	loadsMu   sync.Mutex
+	loads     map[string]*modelLoad // background model loads by ID
+	loadOrder []string
+
+	metrics *metrics
+	cache   *resultCache // nil unless EnableCache was called
+
+	// ModelsDir, if set, is scanned for model files that can be listed and
+	// loaded by ID.
+	ModelsDir string
+	// KeepAlive is how long an idle model stays in memory before it is
+	// unloaded (0 = forever). An unloaded model is reloaded from its path by
+	// the next request that uses it. Requests can override it with keep_alive.
+	KeepAlive time.Duration
+
+	// VADModelPath is the Silero model used for requests with vad=true. When
+	// empty they use the built-in energy VAD.
+	VADModelPath string
+
+	// FFmpegSandbox limits ffmpeg when decoding uploads.
+	FFmpegSandbox audio.Sandbox
+
+	// AllowedDirs restricts client-supplied model and diarizer paths to
+	// these directories (and ModelsDir). When both are empty, any path is
+	// accepted.
+	AllowedDirs []string
+
+	// APIKeys are the accepted bearer tokens. When empty, authentication is
+	// disabled. Must be set before Handler is called.
+	APIKeys []string
+
+	// DrainTimeout is how long in-flight transcriptions may keep running
+	// after shutdown starts before they are aborted.
+	DrainTimeout time.Duration
+	baseCtx      context.Context // ended with errShuttingDown by Close
+	abortAll     context.CancelCauseFunc
+	stopOnce     sync.Once
+	stop         chan struct{} // closed by Stop
+
+	requestsMu sync.Mutex
+	requests   map[string]context.CancelCauseFunc // in-flight synchronous transcriptions by request ID
+
+	jobsMu   sync.Mutex
+	jobs     map[string]*job
+	jobOrder []string // insertion order, used for eviction
+}
+
+// model is a loaded whisper model registered under a name.
+type model struct {
+	name      string
+	path      string
+	gpuDevice int
+	noGpu     bool
+
+	reloadMu sync.Mutex // serializes reloads after an idle unload
+
+	mu       sync.Mutex
+	ctx      *whisper.Context // nil after an idle unload; reloaded on next use
+	loadedAt time.Time
+	users    int              // transcriptions holding a state of ctx
+	retired  bool             // unloaded or replaced; ctx is freed once users drops to 0
+	freed    chan struct{}    // closed once a retired model's ctx is freed
+	ctxBusy  bool             // the default state of ctx is in use
+	idle     []*whisper.State // extra states not in use
+	states   []*whisper.State // all extra states, freed with ctx
+
+	idleMu    sync.Mutex
+	keepAlive time.Duration // idle time before unloading; negative = forever
+	lastUsed  time.Time
+	idleTimer *time.Timer
 }
 
+// defaultModelAlias is the model name stock OpenAI clients send. It selects
+// the default model, same as an empty model field.
+const defaultModelAlias = "whisper-1"
+
+var errModelNotFound = errors.New("model not found")
+
 func New(verbose bool) *Server {
-	return &Server{verbose: verbose}
+	baseCtx, abortAll := context.WithCancelCause(context.Background())
+	return &Server{
+		verbose:       verbose,
+		QueueDepth:    defaultQueueDepth,
+		Concurrency:   1,
+		FFmpegSandbox: audio.DefaultSandbox,
+		DrainTimeout:  defaultDrainTimeout,
+		metrics:       newMetrics(),
+		baseCtx:       baseCtx,
+		abortAll:      abortAll,
+		stop:          make(chan struct{}),
+	}
+}
+
+// LoadModel loads a whisper model under name (empty = file name of path).
+// Other loaded models are kept; a model already loaded under the same name
+// is replaced only once the new one has loaded, so a failed load leaves it
+// in place. gpuDevice selects the GPU (-1 = use whisper default).
+func (s *Server) LoadModel(name, path string, gpuDevice int, noGpu bool) (string, error) {
+	return s.loadModel(name, path, gpuDevice, noGpu, nil)
 }
 
-// LoadModel loads a whisper model, unloading any existing one first.
-// gpuDevice selects the GPU (-1 = use whisper default).
-func (s *Server) LoadModel(path string, gpuDevice int, noGpu bool) error {
+// modelLoaded reports whether at least one model is loaded.
+func (s *Server) modelLoaded() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.models) > 0
+}
+
+// loadModel reads and initializes the model without holding s.mu, so
+// transcriptions keep running on the current models meanwhile, then swaps
+// it in. The swap does not wait for transcriptions still running on a
+// replaced model; that model is freed when the last of them finishes.
+func (s *Server) loadModel(name, path string, gpuDevice int, noGpu bool, onProgress func(progress int)) (string, error) {
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	ctx, err := whisper.NewWithProgress(path, gpuDevice, noGpu, onProgress)
+	if err != nil {
+		return "", err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.loadModelLocked(path, gpuDevice, noGpu)
+	s.addModelLocked(&model{
+		name:      name,
+		path:      path,
+		gpuDevice: gpuDevice,
+		noGpu:     noGpu,
+		ctx:       ctx,
+		loadedAt:  time.Now(),
+		keepAlive: s.defaultKeepAlive(),
+	})
+	return name, nil
 }
 
-func (s *Server) loadModelLocked(path string, gpuDevice int, noGpu bool) error {
-	if s.ctx != nil {
-		s.ctx.Close()
-		s.ctx = nil
-		s.modelName = ""
-		s.modelPath = ""
+// addModelLocked registers m. A model with the same name is retired and
+// replaced in place, keeping its position in the load order.
+func (s *Server) addModelLocked(m *model) {
+	if s.models == nil {
+		s.models = make(map[string]*model)
+	}
+	if old, ok := s.models[m.name]; ok {
+		old.free()
+	} else {
+		s.modelOrder = append(s.modelOrder, m.name)
 	}
+	s.models[m.name] = m
+	s.touchModel(m)
+}
 
-	ctx, err := whisper.New(path, gpuDevice, noGpu)
-	if err != nil {
-		return err
+// free stops the idle timer and retires m, so its whisper context is
+// released once running transcriptions are done with it.
+func (m *model) free() {
+	m.idleMu.Lock()
+	if m.idleTimer != nil {
+		m.idleTimer.Stop()
 	}
-	s.ctx = ctx
-	s.modelPath = path
-	s.modelName = filepath.Base(path)
-	return nil
+	m.idleMu.Unlock()
+	m.retire()
 }
 
-// UnloadModel frees the current model. Safe to call with no model loaded.
-func (s *Server) UnloadModel() {
+// resolveModelLocked returns the model registered under name. An empty name
+// or "whisper-1" selects the default (first loaded) model.
+func (s *Server) resolveModelLocked(name string) (*model, error) {
+	if len(s.modelOrder) == 0 {
+		return nil, errNoModel
+	}
+	if name == "" || name == defaultModelAlias {
+		return s.models[s.modelOrder[0]], nil
+	}
+	m, ok := s.models[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errModelNotFound, name)
+	}
+	return m, nil
+}
+
+// UnloadModel removes the named model and reports whether it was loaded.
+// Its memory is freed once transcriptions running on it finish.
+func (s *Server) UnloadModel(name string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.ctx != nil {
-		s.ctx.Close()
-		s.ctx = nil
-		s.modelName = ""
-		s.modelPath = ""
+	return s.unloadModelLocked(name)
+}
+
+func (s *Server) unloadModelLocked(name string) bool {
+	m, ok := s.models[name]
+	if !ok {
+		return false
 	}
+	m.free()
+	delete(s.models, name)
+	s.modelOrder = slices.DeleteFunc(s.modelOrder, func(n string) bool { return n == name })
+	return true
 }
 
-// Close frees all resources.
+// UnloadAllModels frees every loaded model and waits until running
+// transcriptions have released them. Safe to call with no model loaded.
+func (s *Server) UnloadAllModels() {
+	s.mu.Lock()
+	models := make([]*model, 0, len(s.modelOrder))
+	for _, name := range slices.Clone(s.modelOrder) {
+		models = append(models, s.models[name])
+		s.unloadModelLocked(name)
+	}
+	s.mu.Unlock()
+	for _, m := range models {
+		m.waitFreed()
+	}
+}
+
+// Close aborts running and queued transcriptions and frees all resources.
 func (s *Server) Close() {
-	s.UnloadModel()
+	s.abortAll(errShuttingDown)
+	s.UnloadAllModels() // returns once aborted transcriptions release their models
 }
 
 func (s *Server) Handler() http.Handler {
@@ -82,10 +270,25 @@ func (s *Server) Handler() http.Handler {
 	mux.HandleFunc("GET /ready", s.handleReady)
 	mux.HandleFunc("POST /v1/models/load", s.handleModelLoad)
 	mux.HandleFunc("DELETE /v1/models", s.handleModelUnload)
+	mux.HandleFunc("GET /v1/models/load/{id}", s.handleModelLoadGet)
+	mux.HandleFunc("DELETE /v1/models/{id}", s.handleModelUnloadOne)
 	mux.HandleFunc("POST /v1/audio/transcriptions", s.handleTranscription)
+	mux.HandleFunc("DELETE /v1/audio/transcriptions/{id}", s.handleTranscriptionCancel)
+	mux.HandleFunc("POST /v1/audio/translations", s.handleTranslation)
+	mux.HandleFunc("POST /v1/audio/language", s.handleLanguageDetect)
+	mux.HandleFunc("GET /v1/audio/realtime", s.handleRealtime)
 	mux.HandleFunc("GET /v1/models", s.handleModels)
+	mux.HandleFunc("POST /v1/jobs", s.handleJobCreate)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleJobGet)
+	mux.HandleFunc("DELETE /v1/jobs/{id}", s.handleTranscriptionCancel)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
 	s.registerDocsRoutes(mux)
-	return mux
+
+	var h http.Handler = mux
+	if len(s.APIKeys) > 0 {
+		h = s.requireAPIKey(h)
+	}
+	return s.countRequests(mux, h)
 }
 
 // ListenAndServe binds to the given port (0 = auto-assign), prints a ready
@@ -95,35 +298,77 @@ func ListenAndServe(host string, port int, s *Server) error {
 	if err != nil {
 		return err
 	}
-
 	actualPort := ln.Addr().(*net.TCPAddr).Port
+	log.Printf("listening on %s:%d", host, actualPort)
+	return serve(ln, s, "port", actualPort)
+}
 
+// ListenAndServeUnix is ListenAndServe on a Unix domain socket. The socket
+// is only accessible to the current user. A stale socket left behind by a
+// crashed runner is replaced, and the socket is removed on shutdown.
+func ListenAndServeUnix(path string, s *Server) error {
+	if err := removeStaleSocket(path); err != nil {
+		return err
+	}
+	ln, err := listenUnix(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	log.Printf("listening on %s", path)
+	return serve(ln, s, "socket", path)
+}
+
+// removeStaleSocket removes the socket file at path unless a server is
+// still accepting connections on it. Other kinds of files are left alone.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use by another server", path)
+	}
+	return os.Remove(path)
+}
+
+// serve prints the ready signal, with the listen address under addrKey, and
+// serves on ln until interrupted or stopped.
+func serve(ln net.Listener, s *Server, addrKey string, addr any) error {
 	// Machine-readable ready signal for parent process.
 	readyMsg, _ := json.Marshal(map[string]any{
 		"status":  "ready",
-		"port":    actualPort,
+		addrKey:   addr,
 		"version": s.Version,
 		"commit":  s.Commit,
 	})
 	fmt.Println(string(readyMsg))
-	log.Printf("listening on %s:%d", host, actualPort)
 
 	srv := &http.Server{Handler: s.Handler()}
 
-	// Graceful shutdown on SIGINT/SIGTERM.
+	// Graceful shutdown on SIGINT/SIGTERM or Stop.
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		sigCh := make(chan os.Signal, 1)
 		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-		<-sigCh
-		log.Println("shutting down...")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		srv.Shutdown(ctx)
-		s.Close()
+		select {
+		case <-sigCh:
+		case <-s.stop:
+		}
+		s.shutdown(srv)
 	}()
 
-	err = srv.Serve(ln)
+	err := srv.Serve(ln)
 	if err == http.ErrServerClosed {
+		<-stopped // Serve returns as soon as shutdown starts
 		return nil
 	}
 	return err
@@ -1,10 +1,14 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
 )
 
 func TestHealthEndpoint(t *testing.T) {
@@ -82,3 +86,129 @@ func TestModelUnloadIdempotent(t *testing.T) {
 		t.Errorf("expected status unloaded, got %q", body["status"])
 	}
 }
+
+func TestJobNotFound(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("GET", "/v1/jobs/job_missing", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestJobCreateNoModel(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("POST", "/v1/jobs", nil)
+	w := httptest.NewRecorder()
+	s.handleJobCreate(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
+
+func TestCancelUnknownRequest(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("DELETE", "/v1/audio/transcriptions/req_missing", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestCancelInFlightRequest(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", nil)
+	req.Header.Set("X-Request-Id", "client-42")
+	w := httptest.NewRecorder()
+	ctx, id, stop := s.startRequest(w, req)
+	defer stop()
+
+	if id != "client-42" || w.Header().Get("X-Request-Id") != "client-42" {
+		t.Fatalf("expected client-supplied request ID, got %q", id)
+	}
+
+	cancelReq := httptest.NewRequest("DELETE", "/v1/audio/transcriptions/"+id, nil)
+	cw := httptest.NewRecorder()
+	s.Handler().ServeHTTP(cw, cancelReq)
+	if cw.Code != 200 {
+		t.Fatalf("expected 200, got %d", cw.Code)
+	}
+	if !errors.Is(context.Cause(ctx), errCancelled) {
+		t.Errorf("expected context cancelled with errCancelled, got %v", context.Cause(ctx))
+	}
+}
+
+// addFakeModel registers a model without loading weights from disk.
+func addFakeModel(s *Server, name string) {
+	if s.models == nil {
+		s.models = make(map[string]*model)
+	}
+	s.models[name] = &model{name: name, ctx: &whisper.Context{}}
+	s.modelOrder = append(s.modelOrder, name)
+}
+
+func TestResolveModel(t *testing.T) {
+	s := New(false)
+	if _, err := s.resolveModelLocked(""); !errors.Is(err, errNoModel) {
+		t.Fatalf("expected errNoModel, got %v", err)
+	}
+
+	addFakeModel(s, "ggml-base.en.bin")
+	addFakeModel(s, "ggml-large-v3.bin")
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "ggml-base.en.bin"},
+		{"whisper-1", "ggml-base.en.bin"},
+		{"ggml-large-v3.bin", "ggml-large-v3.bin"},
+	}
+	for _, tt := range tests {
+		m, err := s.resolveModelLocked(tt.name)
+		if err != nil || m.name != tt.want {
+			t.Errorf("resolveModelLocked(%q) = %v, %v; want %q", tt.name, m, err, tt.want)
+		}
+	}
+	if _, err := s.resolveModelLocked("ggml-tiny.bin"); !errors.Is(err, errModelNotFound) {
+		t.Errorf("expected errModelNotFound, got %v", err)
+	}
+}
+
+func TestModelUnloadOne(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "a.bin")
+	addFakeModel(s, "b.bin")
+
+	req := httptest.NewRequest("DELETE", "/v1/models/a.bin", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if len(s.modelOrder) != 1 || s.modelOrder[0] != "b.bin" {
+		t.Errorf("remaining models = %v, want [b.bin]", s.modelOrder)
+	}
+
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/models/a.bin", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unloaded model, got %d", w.Code)
+	}
+}
+
+func TestTranslationNoModel(t *testing.T) {
+	s := New(false)
+	req := httptest.NewRequest("POST", "/v1/audio/translations", nil)
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+}
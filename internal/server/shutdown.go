@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultDrainTimeout = 30 * time.Second
+
+	// shutdownGrace is how long aborted requests get to send their final
+	// event before the remaining connections are closed.
+	shutdownGrace = 5 * time.Second
+)
+
+// errShuttingDown is the context cause for transcriptions aborted because
+// the server is stopping.
+var errShuttingDown = errors.New("server shutting down")
+
+// Stop starts the same graceful shutdown as SIGTERM in ListenAndServe. It
+// may be called before serving starts and more than once.
+func (s *Server) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// shutdown stops srv. New connections are refused while in-flight requests
+// and queued jobs get DrainTimeout to finish; after that they are aborted,
+// and connections still open after shutdownGrace are closed.
+func (s *Server) shutdown(srv *http.Server) {
+	log.Println("shutting down...")
+	abort := time.AfterFunc(s.DrainTimeout, func() {
+		log.Println("drain timeout reached, aborting in-flight transcriptions")
+		s.abortAll(errShuttingDown)
+	})
+	defer abort.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.DrainTimeout+shutdownGrace)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+	}
+	s.waitIdle(ctx)
+	s.Close()
+}
+
+// abortReason returns errCancelled or errShuttingDown when ctx was ended by
+// a cancellation through the API or by shutdown, and nil otherwise.
+func abortReason(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	for _, reason := range []error{errCancelled, errShuttingDown} {
+		if errors.Is(cause, reason) {
+			return reason
+		}
+	}
+	return nil
+}
+
+// writeAbortError answers a transcription that was aborted before any
+// response was written.
+func writeAbortError(w http.ResponseWriter, reason error) {
+	status := http.StatusConflict
+	if reason == errShuttingDown {
+		status = http.StatusServiceUnavailable
+	}
+	writeError(w, status, reason.Error())
+}
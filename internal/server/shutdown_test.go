@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloseAbortsInFlightTranscription(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", nil)
+	ctx, _, stop := s.startRequest(httptest.NewRecorder(), req)
+	defer stop()
+
+	// Stand-in for transcribe: holds the model until ShouldAbort would fire.
+	m, st, err := s.acquireModel("tiny")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		m.release(st)
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on a running transcription")
+	}
+	if !errors.Is(context.Cause(ctx), errShuttingDown) {
+		t.Errorf("expected errShuttingDown, got %v", context.Cause(ctx))
+	}
+	if loaded, _ := m.loadState(); loaded {
+		t.Error("Close returned before the model was freed")
+	}
+}
+
+func TestShutdownAbortsAfterDrainTimeout(t *testing.T) {
+	s := New(false)
+	s.DrainTimeout = 50 * time.Millisecond
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, _, stop := s.startRequest(w, r)
+		defer stop()
+		s.submit(ctx, func() {
+			close(started)
+			<-ctx.Done()
+		})
+		if reason := abortReason(ctx); reason != nil {
+			writeAbortError(w, reason)
+		}
+	})}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+
+	// Queued behind the running request; skipped once shutdown aborts it.
+	queuedRan := false
+	queued := newTask(s.baseCtx, func() { queuedRan = true })
+
+	type response struct {
+		status int
+		body   string
+	}
+	respCh := make(chan response, 1)
+	go func() {
+		resp, err := http.Post("http://"+ln.Addr().String(), "text/plain", nil)
+		if err != nil {
+			respCh <- response{body: err.Error()}
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respCh <- response{resp.StatusCode, string(body)}
+	}()
+	<-started
+	if err := s.enqueue(queued); err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	s.shutdown(srv)
+	resp := <-respCh
+	if resp.status != http.StatusServiceUnavailable || !strings.Contains(resp.body, "server shutting down") {
+		t.Errorf("got %d %q, want 503 server shutting down", resp.status, resp.body)
+	}
+	<-queued.done
+	if queuedRan {
+		t.Error("queued task should be skipped after shutdown")
+	}
+}
+
+func TestShutdownFailsQueuedJob(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	release := make(chan struct{})
+	started := make(chan struct{})
+	s.enqueue(newTask(context.Background(), func() {
+		close(started)
+		<-release
+	}))
+	<-started
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, uploadRequest("/v1/jobs", nativeWav(1), nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	j := s.getJob(w.Header().Get(requestIDHeader))
+
+	s.abortAll(errShuttingDown)
+	close(release)
+	for range 100 {
+		if j.finished() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	j.mu.Lock()
+	status, message := j.statusLocked(), j.errMessage
+	j.mu.Unlock()
+	if status != jobFailed || message != errShuttingDown.Error() {
+		t.Errorf("job is %s (%q), want failed with %q", status, message, errShuttingDown)
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenUnix listens on a Unix domain socket that only the current user can
+// connect to. The umask is narrowed while the socket is created, so it never
+// exists with wider permissions.
+func listenUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0o177)
+	defer syscall.Umask(old)
+	return net.Listen("unix", path)
+}
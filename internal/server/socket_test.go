@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sona.sock")
+	if err := removeStaleSocket(path); err != nil {
+		t.Fatalf("missing socket: %v", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := removeStaleSocket(path); err == nil {
+		t.Error("expected an error for a socket that is in use")
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+	if err := removeStaleSocket(path); err != nil {
+		t.Fatalf("stale socket: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Error("stale socket was not removed")
+	}
+
+	os.WriteFile(path, []byte("data"), 0o644)
+	if err := removeStaleSocket(path); err == nil {
+		t.Error("expected an error for a regular file")
+	}
+}
+
+func TestListenAndServeUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sona.sock")
+	s := New(false)
+	done := make(chan error, 1)
+	go func() { done <- ListenAndServeUnix(path, s) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", path)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for range 50 {
+		if resp, err = client.Get("http://sona/health"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /health over socket: %v", err)
+	}
+	resp.Body.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("socket permissions = %v, want 0600", perm)
+	}
+
+	s.Stop()
+	if err := <-done; err != nil {
+		t.Fatalf("ListenAndServeUnix: %v", err)
+	}
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		t.Error("socket was not removed on shutdown")
+	}
+}
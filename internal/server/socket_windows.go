@@ -0,0 +1,9 @@
+package server
+
+import "net"
+
+// listenUnix listens on a Unix domain socket. Windows has no umask; access
+// follows the ACL the socket file inherits from its directory.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
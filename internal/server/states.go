@@ -0,0 +1,146 @@
+package server
+
+import (
+	"errors"
+	"runtime"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// transcriber runs inference on one whisper state: a model's default state
+// (*whisper.Context) or an extra one (*whisper.State).
+type transcriber interface {
+	TranscribeStream(samples []float32, opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error)
+	DetectLanguage(samples []float32, threads int) ([]whisper.LanguageProb, error)
+}
+
+// errModelUnloaded is returned by acquire when m has no whisper context,
+// because it was unloaded for being idle or removed.
+var errModelUnloaded = errors.New("model unloaded")
+
+// acquire returns a whisper state of m that no other transcription is
+// using: the default state if free, else an idle extra state, else a new
+// one. States are kept until the context is freed, so at most one per queue
+// worker is ever allocated. Each state must be returned with release, which
+// also frees the context once m is retired and no longer in use.
+func (m *model) acquire() (transcriber, error) {
+	m.mu.Lock()
+	if m.ctx == nil || m.retired {
+		m.mu.Unlock()
+		return nil, errModelUnloaded
+	}
+	m.users++
+	if !m.ctxBusy {
+		m.ctxBusy = true
+		m.mu.Unlock()
+		return m.ctx, nil
+	}
+	if n := len(m.idle); n > 0 {
+		st := m.idle[n-1]
+		m.idle = m.idle[:n-1]
+		m.mu.Unlock()
+		return st, nil
+	}
+	// A new state is large; allocate it without holding m.mu. Counting this
+	// caller as a user keeps the context from being freed meanwhile.
+	ctx := m.ctx
+	m.mu.Unlock()
+	st, err := ctx.NewState()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.releaseLocked()
+		return nil, err
+	}
+	m.states = append(m.states, st)
+	return st, nil
+}
+
+// release makes a state returned by acquire available again.
+func (m *model) release(t transcriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if st, ok := t.(*whisper.State); ok {
+		m.idle = append(m.idle, st)
+	} else {
+		m.ctxBusy = false
+	}
+	m.releaseLocked()
+}
+
+// releaseLocked drops one user and frees the context of a retired model
+// once nobody uses it. Requires m.mu locked.
+func (m *model) releaseLocked() {
+	m.users--
+	if m.users == 0 && m.retired {
+		m.closeContextLocked()
+		close(m.freed)
+	}
+}
+
+// retire marks m as no longer registered. Its context is freed right away
+// if no transcription is using it, else by the last release, so callers
+// never wait for running inference.
+func (m *model) retire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.retired {
+		return
+	}
+	m.retired = true
+	m.freed = make(chan struct{})
+	if m.users == 0 {
+		m.closeContextLocked()
+		close(m.freed)
+	}
+}
+
+// waitFreed blocks until the context of a retired model has been freed.
+func (m *model) waitFreed() {
+	m.mu.Lock()
+	freed := m.freed
+	m.mu.Unlock()
+	if freed != nil {
+		<-freed
+	}
+}
+
+// loadState reports whether m's context is in memory and when it was
+// last loaded.
+func (m *model) loadState() (loaded bool, loadedAt time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ctx != nil, m.loadedAt
+}
+
+// closeContextLocked frees the extra states and then the whisper context.
+// Requires m.mu locked and no state in use.
+func (m *model) closeContextLocked() {
+	for _, st := range m.states {
+		st.Close()
+	}
+	m.states, m.idle, m.ctxBusy = nil, nil, false
+	if m.ctx != nil {
+		m.ctx.Close()
+		m.ctx = nil
+	}
+}
+
+// jobThreads returns the CPU threads for one transcription, given the
+// n_threads the client asked for (0 = unset). Each job is capped to its
+// share of the CPUs so concurrent jobs do not oversubscribe them.
+func (s *Server) jobThreads(requested int) int {
+	budget := s.ThreadsPerJob
+	if budget <= 0 {
+		budget = max(1, runtime.NumCPU()/max(1, s.Concurrency))
+	}
+	if requested <= 0 {
+		if s.ThreadsPerJob > 0 {
+			return budget
+		}
+		return min(4, budget) // whisper's own default on a single worker
+	}
+	return min(requested, budget)
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/thewh1teagle/sona/internal/diarize"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// wantsSSE reports whether a streaming request gets OpenAI-style
+// Server-Sent Events, the default so stock OpenAI SDKs can read the stream.
+// sona's NDJSON protocol is selected with stream_format=ndjson or an Accept
+// header that includes application/x-ndjson.
+func wantsSSE(r *http.Request) bool {
+	switch r.FormValue("stream_format") {
+	case "sse":
+		return true
+	case "ndjson":
+		return false
+	}
+	return !strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
+}
+
+// eventStream writes streaming transcription events either as sona's NDJSON
+// protocol (progress/segment/result/error) or as OpenAI-compatible SSE
+// (transcript.text.delta/transcript.text.done).
+type eventStream struct {
+	w            http.ResponseWriter
+	flusher      http.Flusher
+	sse          bool
+	diarSegments []diarize.Segment // adds speaker labels to NDJSON segments
+}
+
+// start writes the response headers.
+func (es *eventStream) start() {
+	if es.sse {
+		es.w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		es.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	es.w.Header().Set("Cache-Control", "no-cache")
+	es.w.Header().Set("Connection", "keep-alive")
+	es.w.WriteHeader(http.StatusOK)
+}
+
+// progress reports inference progress. SSE has no progress event, so it is
+// only sent in NDJSON mode.
+func (es *eventStream) progress(progress int) {
+	if es.sse {
+		return
+	}
+	es.emit(map[string]any{
+		"type":     "progress",
+		"progress": progress,
+	})
+}
+
+func (es *eventStream) segment(seg whisper.Segment) {
+	if es.sse {
+		es.emit(map[string]any{
+			"type":  "transcript.text.delta",
+			"delta": seg.Text,
+		})
+		return
+	}
+	event := map[string]any{
+		"type":           "segment",
+		"start":          csToSeconds(seg.Start),
+		"end":            csToSeconds(seg.End),
+		"text":           seg.Text,
+		"avg_logprob":    seg.AvgLogprob,
+		"no_speech_prob": seg.NoSpeechProb,
+	}
+	if es.diarSegments != nil {
+		if sp := matchSpeaker(csToSeconds(seg.Start), csToSeconds(seg.End), es.diarSegments); sp >= 0 {
+			event["speaker"] = sp
+		}
+	}
+	es.emit(event)
+}
+
+// done sends the final transcript, with the detected language in NDJSON mode.
+func (es *eventStream) done(result whisper.TranscribeResult) {
+	if es.sse {
+		es.emit(map[string]any{
+			"type": "transcript.text.done",
+			"text": result.Text(),
+		})
+		return
+	}
+	event := map[string]any{
+		"type": "result",
+		"text": result.Text(),
+	}
+	if result.Language != "" {
+		event["language"] = result.Language
+	}
+	es.emit(event)
+}
+
+// replay streams a result that is already complete, such as a cache hit,
+// as if it had just been transcribed.
+func (es *eventStream) replay(result whisper.TranscribeResult) {
+	for _, seg := range result.Segments {
+		es.segment(seg)
+	}
+	es.progress(100)
+	es.done(result)
+}
+
+// fail reports an error after headers were sent. The SSE shape carries an
+// "error" object, which OpenAI SDKs raise as an API error.
+func (es *eventStream) fail(message string) {
+	if es.sse {
+		es.emit(map[string]any{
+			"type":  "error",
+			"error": map[string]string{"message": message},
+		})
+		return
+	}
+	es.emit(map[string]any{
+		"type":    "error",
+		"message": message,
+	})
+}
+
+func (es *eventStream) emit(event map[string]any) {
+	if es.sse {
+		data, _ := json.Marshal(event)
+		fmt.Fprintf(es.w, "data: %s\n\n", data)
+	} else {
+		json.NewEncoder(es.w).Encode(event)
+	}
+	es.flusher.Flush()
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func TestWantsSSE(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v1/audio/transcriptions", nil)
+	if !wantsSSE(req) {
+		t.Error("default should be SSE")
+	}
+
+	req = httptest.NewRequest("POST", "/v1/audio/transcriptions?stream_format=ndjson", nil)
+	if wantsSSE(req) {
+		t.Error("stream_format=ndjson should select NDJSON")
+	}
+
+	req = httptest.NewRequest("POST", "/v1/audio/transcriptions", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	if wantsSSE(req) {
+		t.Error("Accept: application/x-ndjson should select NDJSON")
+	}
+
+	req = httptest.NewRequest("POST", "/v1/audio/transcriptions?stream_format=sse", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	if !wantsSSE(req) {
+		t.Error("stream_format should take precedence over Accept")
+	}
+}
+
+func TestEventStreamSSE(t *testing.T) {
+	w := httptest.NewRecorder()
+	es := &eventStream{w: w, flusher: w, sse: true}
+	es.start()
+	es.progress(50)
+	es.segment(whisper.Segment{Start: 0, End: 250, Text: " Hello"})
+	es.done(whisper.TranscribeResult{Segments: []whisper.Segment{{Text: " Hello"}}})
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	want := "data: {\"delta\":\" Hello\",\"type\":\"transcript.text.delta\"}\n\n" +
+		"data: {\"text\":\" Hello\",\"type\":\"transcript.text.done\"}\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestEventStreamNDJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	es := &eventStream{w: w, flusher: w}
+	es.start()
+	es.segment(whisper.Segment{Start: 0, End: 250, Text: " Hello", AvgLogprob: -0.25, NoSpeechProb: 0.01})
+	es.done(whisper.TranscribeResult{Segments: []whisper.Segment{{Text: " Hello"}}, Language: "en"})
+
+	want := "{\"avg_logprob\":-0.25,\"end\":2.5,\"no_speech_prob\":0.01,\"start\":0,\"text\":\" Hello\",\"type\":\"segment\"}\n" +
+		"{\"language\":\"en\",\"text\":\" Hello\",\"type\":\"result\"}\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%q\nwant:\n%q", got, want)
+	}
+}
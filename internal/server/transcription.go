@@ -0,0 +1,311 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+	"github.com/thewh1teagle/sona/internal/diarize"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+// maxDecoders is whisper.cpp's WHISPER_MAX_DECODERS, the upper bound for
+// best_of and beam_size.
+const maxDecoders = 8
+
+// defaultBeamSize is whisper.cpp's beam width, used when beam_search is
+// requested without beam_size.
+const defaultBeamSize = 5
+
+// maxGrammarPenalty bounds grammar_penalty; whisper.cpp defaults to 100.
+const maxGrammarPenalty = 1000
+
+// errNoModel is returned when a queued transcription starts but all models
+// were unloaded in the meantime.
+var errNoModel = errors.New("no model loaded")
+
+// transcriptionRequest is a decoded transcription upload together with the
+// options parsed from its multipart form.
+type transcriptionRequest struct {
+	samples        []float32
+	cuts           audio.Cuts // silence removed from samples by enhance_audio
+	model          string     // requested model name; empty selects the default
+	opts           whisper.TranscribeOptions
+	responseFormat string
+	stream         bool
+	sse            bool           // stream as OpenAI-style Server-Sent Events instead of NDJSON
+	keepAlive      *time.Duration // keep_alive, applied to the model once the request has run
+	cacheKey       string         // result cache key, set by cachedResult; empty = not cached
+	diarizeModel   string
+	audioPath      string   // native WAV on disk, set when diarization is requested
+	tempFiles      []string // removed by Close
+}
+
+// Close removes temporary files created while decoding the upload.
+func (req *transcriptionRequest) Close() {
+	for _, path := range req.tempFiles {
+		os.Remove(path)
+	}
+	req.tempFiles = nil
+}
+
+// parseTranscriptionRequest reads the multipart form shared by
+// /v1/audio/transcriptions and /v1/jobs and decodes the audio. On failure it
+// writes the error response and returns false.
+func (s *Server) parseTranscriptionRequest(w http.ResponseWriter, r *http.Request) (*transcriptionRequest, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeInvalidParam(w, &invalidParamError{param: "file", message: "missing or invalid 'file' field: " + err.Error()})
+		return nil, false
+	}
+	defer file.Close()
+
+	// Validate every option before spending time on the audio.
+	f := &formReader{r: r}
+	req := &transcriptionRequest{
+		model:          r.FormValue("model"),
+		diarizeModel:   r.FormValue("diarize_model"),
+		responseFormat: f.oneOf("response_format", "json", "json", "text", "verbose_json", "srt", "vtt"),
+		stream:         f.bool("stream"),
+	}
+	f.oneOf("stream_format", "sse", "sse", "ndjson")
+	req.sse = wantsSSE(r)
+	enhanceAudio := f.bool("enhance_audio")
+	samplingStrategy := f.oneOf("sampling_strategy", "greedy", "greedy", "beam_search")
+	grammar, grammarRule := f.grammar("grammar", "grammar_rule")
+	req.opts = whisper.TranscribeOptions{
+		Language:       f.language("language"),
+		DetectLanguage: f.bool("detect_language"),
+		Translate:      f.bool("translate"),
+		Threads:        f.int("n_threads", 1, runtime.NumCPU()),
+		Prompt:         r.FormValue("prompt"),
+		Verbose:        s.verbose,
+		Temperature:    f.float("temperature", 0, 1),
+		MaxTextCtx:     f.int("max_text_ctx", 0, math.MaxInt32),
+		WordTimestamps: f.bool("word_timestamps"),
+		MaxSegmentLen:  f.int("max_segment_len", 0, math.MaxInt32),
+		SamplingGreedy: samplingStrategy == "greedy",
+		BestOf:         f.int("best_of", 1, maxDecoders),
+		BeamSize:       f.int("beam_size", 1, maxDecoders),
+		VAD:            f.bool("vad"),
+		Grammar:        grammar,
+		GrammarRule:    grammarRule,
+		GrammarPenalty: f.float("grammar_penalty", 0, maxGrammarPenalty),
+	}
+	if !req.opts.SamplingGreedy && req.opts.BeamSize == 0 {
+		// whisper.TranscribeOptions only switches to beam search with a width.
+		req.opts.BeamSize = defaultBeamSize
+	}
+	if req.opts.VAD {
+		req.opts.VADModelPath = s.VADModelPath
+	}
+	// OpenAI clients send timestamp_granularities[]=word; segment timestamps
+	// are always returned.
+	if slices.Contains(f.list("timestamp_granularities[]", "word", "segment"), "word") ||
+		slices.Contains(f.list("timestamp_granularities", "word", "segment"), "word") {
+		req.opts.WordTimestamps = true
+	}
+	if keepAlive, ok := f.keepAlive("keep_alive"); ok {
+		req.keepAlive = &keepAlive
+	}
+	if req.diarizeModel != "" && f.err == nil {
+		// diarize_model is passed to a subprocess; keep it inside the allowed
+		// directories.
+		if req.diarizeModel, err = s.resolveClientPath(req.diarizeModel); err != nil {
+			f.fail("diarize_model", "%v", err)
+		}
+	}
+	if f.err != nil {
+		writeInvalidParam(w, f.err)
+		return nil, false
+	}
+
+	// If diarization requested, save upload to temp file, then convert to
+	// native 16kHz mono PCM WAV so sona-diarize can read it. The converted
+	// file is also used for whisper (skips its own ffmpeg pass).
+	var fileReader io.ReadSeeker = file
+	if req.diarizeModel != "" {
+		tmp, tmpErr := os.CreateTemp("", "sona-diar-*.audio")
+		if tmpErr != nil {
+			log.Printf("failed to create temp file: %v", tmpErr)
+			writeError(w, http.StatusInternalServerError, "failed to create temp file")
+			return nil, false
+		}
+		req.tempFiles = append(req.tempFiles, tmp.Name())
+		if _, copyErr := io.Copy(tmp, file); copyErr != nil {
+			tmp.Close()
+			req.Close()
+			log.Printf("failed to buffer upload: %v", copyErr)
+			writeError(w, http.StatusInternalServerError, "failed to buffer upload")
+			return nil, false
+		}
+		tmp.Close()
+
+		// Convert to native WAV for diarization (and reuse for whisper).
+		nativeWav := tmp.Name() + ".wav"
+		req.tempFiles = append(req.tempFiles, nativeWav)
+		if convErr := audio.ConvertToNativeWavWithOptions(tmp.Name(), nativeWav, audio.ConvertOptions{
+			Sandbox: &s.FFmpegSandbox,
+		}); convErr != nil {
+			log.Printf("failed to convert audio to native WAV: %v", convErr)
+			req.Close()
+			writeAudioError(w, "failed to convert audio for diarization", convErr)
+			return nil, false
+		}
+		req.audioPath = nativeWav
+
+		// Reopen converted file for audio decoding
+		reopened, reopenErr := os.Open(nativeWav)
+		if reopenErr != nil {
+			req.Close()
+			log.Printf("failed to reopen converted file: %v", reopenErr)
+			writeError(w, http.StatusInternalServerError, "failed to reopen converted file")
+			return nil, false
+		}
+		defer reopened.Close()
+		fileReader = reopened
+	}
+
+	req.samples, err = audio.ReadWithOptions(fileReader, audio.ReadOptions{
+		Sandbox: &s.FFmpegSandbox,
+	})
+	if err != nil {
+		req.Close()
+		log.Printf("failed to decode audio: %v", err)
+		writeAudioError(w, "invalid audio file", err)
+		return nil, false
+	}
+	if enhanceAudio {
+		req.samples, req.cuts = audio.RemoveSilence(req.samples)
+	}
+	return req, true
+}
+
+// transcribeRequest runs whisper on req and stores the result in the cache
+// if cachedResult gave req a key. Segment times, streamed and returned,
+// refer to the uploaded audio even when enhance_audio removed silence from
+// it.
+func (s *Server) transcribeRequest(ctx context.Context, req *transcriptionRequest, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+	if onSegment := cb.OnSegment; onSegment != nil && len(req.cuts) > 0 {
+		cb.OnSegment = func(seg whisper.Segment) { onSegment(seg.MapTimes(req.cuts.OriginalTime)) }
+	}
+	result, err := s.transcribe(ctx, req.model, req.samples, req.opts, cb)
+	if err != nil {
+		return result, err
+	}
+	if req.cacheKey != "" && ctx.Err() == nil { // an aborted run may be partial
+		s.cache.put(req.cacheKey, result)
+	}
+	s.applyKeepAlive(req)
+	if len(req.cuts) > 0 {
+		result = result.MapTimes(req.cuts.OriginalTime)
+	}
+	return result, nil
+}
+
+// applyKeepAlive sets the keep_alive a request asked for. It runs only
+// after the request succeeded, so a rejected request leaves the model's
+// keep-alive as it was.
+func (s *Server) applyKeepAlive(req *transcriptionRequest) {
+	if req.keepAlive != nil {
+		s.setKeepAlive(req.model, *req.keepAlive)
+	}
+}
+
+// writeAudioError writes a 400 for an upload that could not be decoded.
+// Decoding errors can carry ffmpeg output with temp file paths, so only
+// the sandbox limit error is passed on to the client.
+func writeAudioError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, audio.ErrTooLong) {
+		message += ": " + err.Error()
+	}
+	writeError(w, http.StatusBadRequest, message)
+}
+
+type diarResult struct {
+	segments []diarize.Segment
+	err      error
+}
+
+// startDiarization runs sona-diarize in the background if the request asked
+// for it. It returns nil when diarization was not requested.
+func (s *Server) startDiarization(req *transcriptionRequest) chan diarResult {
+	if req.diarizeModel == "" || req.audioPath == "" {
+		return nil
+	}
+	diarCh := make(chan diarResult, 1)
+	go func() {
+		start := time.Now()
+		segs, dErr := diarize.Diarize(req.diarizeModel, req.audioPath)
+		s.metrics.observeDiarization(time.Since(start), dErr)
+		diarCh <- diarResult{segs, dErr}
+	}()
+	return diarCh
+}
+
+// collectDiarization waits for a background diarization and returns its
+// segments, or nil if it was not started or failed (failures are logged).
+func collectDiarization(diarCh chan diarResult) []diarize.Segment {
+	if diarCh == nil {
+		return nil
+	}
+	dr := <-diarCh
+	if dr.err != nil {
+		log.Printf("diarization failed (skipping): %v", dr.err)
+		return nil
+	}
+	return dr.segments
+}
+
+// checkModel writes a 503 or 404 response and returns false if the named
+// model cannot serve a transcription.
+func (s *Server) checkModel(w http.ResponseWriter, name string) bool {
+	s.mu.RLock()
+	_, err := s.resolveModelLocked(name)
+	s.mu.RUnlock()
+	return err == nil || !writeModelError(w, err)
+}
+
+// writeModelError maps errNoModel to 503 and errModelNotFound to 404. It
+// returns false, writing nothing, for any other error.
+func writeModelError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, errNoModel):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, errModelNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		return false
+	}
+	return true
+}
+
+// transcribe runs inference on the named model (empty = default model),
+// reloading it if it was unloaded for being idle.
+// ShouldAbort is derived from ctx; any ShouldAbort already set in cb is ignored.
+func (s *Server) transcribe(ctx context.Context, modelName string, samples []float32, opts whisper.TranscribeOptions, cb whisper.StreamCallbacks) (whisper.TranscribeResult, error) {
+	m, st, err := s.acquireModel(modelName)
+	if err != nil {
+		return whisper.TranscribeResult{}, err
+	}
+	defer s.touchModel(m)
+	defer m.release(st)
+	opts.Threads = s.jobThreads(opts.Threads)
+	cb.ShouldAbort = func() bool { return ctx.Err() != nil }
+	start := time.Now()
+	result, err := st.TranscribeStream(samples, opts, cb)
+	if err == nil {
+		s.metrics.observeTranscription(time.Since(start), float64(len(samples))/whisper.SampleRate)
+	}
+	return result, err
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/thewh1teagle/sona/internal/audio"
+	"github.com/thewh1teagle/sona/internal/whisper"
+)
+
+func TestCachedResultMapsCuts(t *testing.T) {
+	s := New(false)
+	if err := s.EnableCache(t.TempDir(), 1<<20); err != nil {
+		t.Fatal(err)
+	}
+	modelPath := filepath.Join(t.TempDir(), "ggml-tiny.bin")
+	os.WriteFile(modelPath, []byte("weights"), 0o644)
+	addFakeModel(s, "tiny")
+	s.models["tiny"].path = modelPath
+
+	// 2s of silence were cut at 1s; whisper saw the shortened audio.
+	req := &transcriptionRequest{
+		samples: []float32{0.1, 0.2, 0.3},
+		cuts:    audio.Cuts{{Start: 16000, End: 3 * 16000}},
+		model:   "tiny",
+	}
+	if _, ok := s.cachedResult(req); ok {
+		t.Fatal("unexpected cache hit")
+	}
+	s.cache.put(req.cacheKey, whisper.TranscribeResult{Segments: []whisper.Segment{
+		{Start: 0, End: 100, Text: " One"},
+		{Start: 100, End: 150, Text: " Two"},
+	}})
+
+	result, ok := s.cachedResult(req)
+	if !ok {
+		t.Fatal("expected a cache hit")
+	}
+	if segs := result.Segments; len(segs) != 2 || segs[0].End != 100 || segs[1].Start != 300 || segs[1].End != 350 {
+		t.Errorf("segments not mapped to the uploaded audio: %+v", segs)
+	}
+}
+
+func TestBeamSearchDefaultsBeamSize(t *testing.T) {
+	s := New(false)
+	addFakeModel(s, "tiny")
+	req, ok := s.parseTranscriptionRequest(httptest.NewRecorder(), uploadRequest("/v1/audio/transcriptions", nativeWav(1), map[string]string{"sampling_strategy": "beam_search"}))
+	if !ok {
+		t.Fatal("failed to parse upload")
+	}
+	req.Close()
+	if req.opts.SamplingGreedy || req.opts.BeamSize != defaultBeamSize {
+		t.Errorf("greedy = %v, beam size = %d; want beam search with %d", req.opts.SamplingGreedy, req.opts.BeamSize, defaultBeamSize)
+	}
+}
@@ -0,0 +1,442 @@
+package whisper
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultGrammarRule is the start rule used when none is given.
+const DefaultGrammarRule = "root"
+
+// grammarType mirrors whisper.cpp's enum whisper_gretype.
+type grammarType uint32
+
+const (
+	greEnd          grammarType = iota // end of rule definition
+	greAlt                             // start of an alternate definition
+	greRuleRef                         // reference to a rule
+	greChar                            // character (code point)
+	greCharNot                         // inverse character class ([^a])
+	greCharRngUpper                    // upper end of a range ([a-z])
+	greCharAlt                         // additional character of a class ([ab])
+)
+
+type grammarElement struct {
+	typ   grammarType
+	value uint32 // code point or rule ID
+}
+
+// Grammar is a parsed GBNF grammar, in the form whisper.cpp's grammar
+// sampler takes it: rules indexed by ID, each a list of elements.
+type Grammar struct {
+	rules [][]grammarElement
+	start int // ID of the start rule
+}
+
+// ParseGrammar parses a GBNF grammar (the format of llama.cpp and
+// whisper.cpp) and checks that it defines startRule (empty = "root").
+func ParseGrammar(src, startRule string) (*Grammar, error) {
+	if startRule == "" {
+		startRule = DefaultGrammarRule
+	}
+	p := &grammarParser{src: src, symbols: make(map[string]uint32), defined: make(map[uint32]int)}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	id, ok := p.symbols[startRule]
+	if !ok || int(id) >= len(p.rules) || p.rules[id] == nil {
+		return nil, fmt.Errorf("grammar does not define start rule %q", startRule)
+	}
+	return &Grammar{rules: p.rules, start: int(id)}, nil
+}
+
+// grammarParser is a port of whisper.cpp's examples/grammar-parser.cpp.
+// Repetitions and groups are rewritten into generated rules:
+//
+//	S* --> S' ::= S S' |
+//	S+ --> S' ::= S S' | S
+//	S? --> S' ::= S |
+type grammarParser struct {
+	src       string
+	pos       int
+	symbols   map[string]uint32
+	rules     [][]grammarElement
+	ruleStart int            // position of the rule being parsed
+	defined   map[uint32]int // position of the rule that defines each ID
+}
+
+// grammarError is a parse error at a position of the grammar text.
+type grammarError struct {
+	line, col int
+	msg       string
+}
+
+func (e *grammarError) Error() string {
+	return fmt.Sprintf("grammar line %d, column %d: %s", e.line, e.col, e.msg)
+}
+
+func (p *grammarParser) errorf(format string, args ...any) error {
+	before := p.src[:min(p.pos, len(p.src))]
+	line := strings.Count(before, "\n") + 1
+	col := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+	return &grammarError{line, col, fmt.Sprintf(format, args...)}
+}
+
+// peek returns the byte at the current position, or 0 at the end.
+func (p *grammarParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *grammarParser) atEnd() bool { return p.pos >= len(p.src) }
+
+func (p *grammarParser) symbolID(name string) uint32 {
+	if id, ok := p.symbols[name]; ok {
+		return id
+	}
+	id := uint32(len(p.symbols))
+	p.symbols[name] = id
+	return id
+}
+
+func (p *grammarParser) generateSymbolID(base string) uint32 {
+	id := uint32(len(p.symbols))
+	p.symbols[base+"_"+strconv.Itoa(int(id))] = id
+	p.defined[id] = p.ruleStart
+	return id
+}
+
+func (p *grammarParser) addRule(id uint32, rule []grammarElement) {
+	for len(p.rules) <= int(id) {
+		p.rules = append(p.rules, nil)
+	}
+	p.rules[id] = rule
+}
+
+func isWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// skipSpace skips blanks and comments, and newlines if newlineOK.
+func (p *grammarParser) skipSpace(newlineOK bool) {
+	for !p.atEnd() {
+		switch c := p.peek(); {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			for !p.atEnd() && p.peek() != '\r' && p.peek() != '\n' {
+				p.pos++
+			}
+		case newlineOK && (c == '\r' || c == '\n'):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *grammarParser) parseName() (string, error) {
+	start := p.pos
+	for !p.atEnd() && isWordChar(p.peek()) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", p.errorf("expecting name")
+	}
+	return p.src[start:p.pos], nil
+}
+
+// parseChar reads one possibly escaped character of a literal or class.
+func (p *grammarParser) parseChar() (uint32, error) {
+	if p.atEnd() {
+		return 0, p.errorf("unexpected end of input")
+	}
+	if p.peek() != '\\' {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.pos += size
+		return uint32(r), nil
+	}
+	p.pos++
+	if p.atEnd() {
+		return 0, p.errorf("unexpected end of input")
+	}
+	c := p.peek()
+	p.pos++
+	switch c {
+	case 'x', 'u', 'U':
+		digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[c]
+		if p.pos+digits > len(p.src) {
+			return 0, p.errorf("expecting %d hex digits", digits)
+		}
+		v, err := strconv.ParseUint(p.src[p.pos:p.pos+digits], 16, 32)
+		if err != nil {
+			return 0, p.errorf("expecting %d hex digits", digits)
+		}
+		p.pos += digits
+		return uint32(v), nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case 'n':
+		return '\n', nil
+	case '\\', '"', '[', ']':
+		return uint32(c), nil
+	}
+	p.pos--
+	return 0, p.errorf("unknown escape \\%c", c)
+}
+
+func (p *grammarParser) parseSequence(ruleName string, out []grammarElement, nested bool) ([]grammarElement, error) {
+	lastSymStart := len(out)
+	for !p.atEnd() {
+		switch c := p.peek(); {
+		case c == '"': // literal string
+			p.pos++
+			lastSymStart = len(out)
+			for p.peek() != '"' {
+				ch, err := p.parseChar()
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, grammarElement{greChar, ch})
+			}
+			p.pos++
+			p.skipSpace(nested)
+		case c == '[': // character class
+			p.pos++
+			startType := greChar
+			if p.peek() == '^' {
+				p.pos++
+				startType = greCharNot
+			}
+			lastSymStart = len(out)
+			for p.peek() != ']' {
+				ch, err := p.parseChar()
+				if err != nil {
+					return nil, err
+				}
+				typ := startType
+				if len(out) > lastSymStart {
+					typ = greCharAlt
+				}
+				out = append(out, grammarElement{typ, ch})
+				if p.peek() == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] != ']' {
+					p.pos++
+					upper, err := p.parseChar()
+					if err != nil {
+						return nil, err
+					}
+					out = append(out, grammarElement{greCharRngUpper, upper})
+				}
+			}
+			p.pos++
+			p.skipSpace(nested)
+		case isWordChar(c): // rule reference
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace(nested)
+			lastSymStart = len(out)
+			out = append(out, grammarElement{greRuleRef, p.symbolID(name)})
+		case c == '(': // grouping
+			p.pos++
+			p.skipSpace(true)
+			subID := p.generateSymbolID(ruleName)
+			if err := p.parseAlternates(ruleName, subID, true); err != nil {
+				return nil, err
+			}
+			lastSymStart = len(out)
+			out = append(out, grammarElement{greRuleRef, subID})
+			if p.peek() != ')' {
+				return nil, p.errorf("expecting ')'")
+			}
+			p.pos++
+			p.skipSpace(nested)
+		case c == '*' || c == '+' || c == '?':
+			if lastSymStart == len(out) {
+				return nil, p.errorf("expecting an item before %c", c)
+			}
+			subID := p.generateSymbolID(ruleName)
+			sym := out[lastSymStart:]
+			sub := append([]grammarElement(nil), sym...)
+			if c != '?' {
+				sub = append(sub, grammarElement{greRuleRef, subID})
+			}
+			sub = append(sub, grammarElement{greAlt, 0})
+			if c == '+' {
+				sub = append(sub, sym...)
+			}
+			sub = append(sub, grammarElement{greEnd, 0})
+			p.addRule(subID, sub)
+			out = append(out[:lastSymStart], grammarElement{greRuleRef, subID})
+			p.pos++
+			p.skipSpace(nested)
+		default:
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+func (p *grammarParser) parseAlternates(ruleName string, ruleID uint32, nested bool) error {
+	rule, err := p.parseSequence(ruleName, nil, nested)
+	if err != nil {
+		return err
+	}
+	for p.peek() == '|' {
+		rule = append(rule, grammarElement{greAlt, 0})
+		p.pos++
+		p.skipSpace(true)
+		if rule, err = p.parseSequence(ruleName, rule, nested); err != nil {
+			return err
+		}
+	}
+	p.addRule(ruleID, append(rule, grammarElement{greEnd, 0}))
+	return nil
+}
+
+func (p *grammarParser) parseRule() error {
+	p.ruleStart = p.pos
+	name, err := p.parseName()
+	if err != nil {
+		return err
+	}
+	p.skipSpace(false)
+	id := p.symbolID(name)
+	p.defined[id] = p.ruleStart
+	if !strings.HasPrefix(p.src[p.pos:], "::=") {
+		return p.errorf("expecting ::=")
+	}
+	p.pos += 3
+	p.skipSpace(true)
+	if err := p.parseAlternates(name, id, false); err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "\r\n"):
+		p.pos += 2
+	case p.peek() == '\n' || p.peek() == '\r':
+		p.pos++
+	case !p.atEnd():
+		return p.errorf("expecting newline or end")
+	}
+	p.skipSpace(true)
+	return nil
+}
+
+func (p *grammarParser) parse() error {
+	p.skipSpace(true)
+	for !p.atEnd() {
+		if err := p.parseRule(); err != nil {
+			return err
+		}
+	}
+	if len(p.rules) == 0 {
+		return fmt.Errorf("grammar defines no rules")
+	}
+	// Every referenced rule must be defined.
+	names := make(map[uint32]string, len(p.symbols))
+	for name, id := range p.symbols {
+		names[id] = name
+	}
+	for _, rule := range p.rules {
+		for _, el := range rule {
+			if el.typ == greRuleRef && (int(el.value) >= len(p.rules) || p.rules[el.value] == nil) {
+				return fmt.Errorf("grammar references undefined rule %q", names[el.value])
+			}
+		}
+	}
+	if id, ok := p.leftRecursion(); ok {
+		// Report generated rules (name_N) under the rule they come from.
+		name, _, _ := strings.Cut(names[id], "_")
+		p.pos = p.defined[id]
+		return p.errorf("rule %q is left-recursive", name)
+	}
+	return nil
+}
+
+// alternatives splits a rule into its alternatives, without the greAlt and
+// greEnd markers.
+func alternatives(rule []grammarElement) [][]grammarElement {
+	var alts [][]grammarElement
+	start := 0
+	for i, el := range rule {
+		if el.typ == greAlt || el.typ == greEnd {
+			alts = append(alts, rule[start:i])
+			start = i + 1
+		}
+	}
+	return alts
+}
+
+// leftRecursion reports a rule that can reach itself without consuming a
+// character, such as root ::= root "a", or a ::= b a with b able to match
+// the empty string. whisper.cpp expands such rules until the stack
+// overflows. Like llama.cpp's detect_left_recursion, it follows the
+// leftmost rule reference of each alternative and the ones after it while
+// the references before them are nullable; nullability also propagates
+// through references here.
+func (p *grammarParser) leftRecursion() (uint32, bool) {
+	nullable := make([]bool, len(p.rules))
+	for changed := true; changed; {
+		changed = false
+		for id, rule := range p.rules {
+			if nullable[id] {
+				continue
+			}
+			for _, alt := range alternatives(rule) {
+				if !slices.ContainsFunc(alt, func(el grammarElement) bool {
+					return el.typ != greRuleRef || !nullable[el.value]
+				}) {
+					nullable[id], changed = true, true
+					break
+				}
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make([]int, len(p.rules))
+	var visit func(id uint32) (uint32, bool)
+	visit = func(id uint32) (uint32, bool) {
+		switch state[id] {
+		case inProgress:
+			return id, true
+		case done:
+			return 0, false
+		}
+		state[id] = inProgress
+		for _, alt := range alternatives(p.rules[id]) {
+			for _, el := range alt {
+				if el.typ != greRuleRef {
+					break
+				}
+				if found, ok := visit(el.value); ok {
+					return found, true
+				}
+				if !nullable[el.value] {
+					break
+				}
+			}
+		}
+		state[id] = done
+		return 0, false
+	}
+	for id := range p.rules {
+		if found, ok := visit(uint32(id)); ok {
+			return found, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,106 @@
+package whisper
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseGrammar(t *testing.T) {
+	g, err := ParseGrammar(`
+# yes or no, then digits
+root  ::= answer " " [0-9]+
+answer ::= "yes" | "no"
+`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.start != 0 {
+		t.Errorf("start rule = %d, want 0", g.start)
+	}
+	want := [][]grammarElement{
+		// root
+		{{greRuleRef, 1}, {greChar, ' '}, {greRuleRef, 2}, {greEnd, 0}},
+		// answer
+		{{greChar, 'y'}, {greChar, 'e'}, {greChar, 's'}, {greAlt, 0}, {greChar, 'n'}, {greChar, 'o'}, {greEnd, 0}},
+		// root_2 ::= [0-9] root_2 | [0-9]
+		{{greChar, '0'}, {greCharRngUpper, '9'}, {greRuleRef, 2}, {greAlt, 0}, {greChar, '0'}, {greCharRngUpper, '9'}, {greEnd, 0}},
+	}
+	if len(g.rules) != len(want) {
+		t.Fatalf("got %d rules, want %d: %v", len(g.rules), len(want), g.rules)
+	}
+	for i := range want {
+		if !slices.Equal(g.rules[i], want[i]) {
+			t.Errorf("rule %d = %v, want %v", i, g.rules[i], want[i])
+		}
+	}
+}
+
+func TestParseGrammarClasses(t *testing.T) {
+	g, err := ParseGrammar(`cmd ::= [^\n"] ("a" | "\x62")? [cé]`, "cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []grammarElement{
+		{greCharNot, '\n'}, {greCharAlt, '"'},
+		{greRuleRef, 2},
+		{greChar, 'c'}, {greCharAlt, 'é'},
+		{greEnd, 0},
+	}
+	if !slices.Equal(g.rules[0], want) {
+		t.Errorf("rule = %v, want %v", g.rules[0], want)
+	}
+	// cmd_1 ::= "a" | "b"; cmd_2 ::= cmd_1 |
+	if want := []grammarElement{{greChar, 'a'}, {greAlt, 0}, {greChar, 'b'}, {greEnd, 0}}; !slices.Equal(g.rules[1], want) {
+		t.Errorf("group rule = %v, want %v", g.rules[1], want)
+	}
+	if want := []grammarElement{{greRuleRef, 1}, {greAlt, 0}, {greEnd, 0}}; !slices.Equal(g.rules[2], want) {
+		t.Errorf("optional rule = %v, want %v", g.rules[2], want)
+	}
+}
+
+func TestParseGrammarErrors(t *testing.T) {
+	tests := []struct {
+		src, rule, want string
+	}{
+		{"", "", "no rules"},
+		{`root ::= other`, "", `undefined rule "other"`},
+		{`root = "a"`, "", "line 1, column 6: expecting ::="},
+		{"root ::= \"a\"\nnext ::= \"b", "", "line 2, column 12: unexpected end of input"},
+		{`root ::= [a`, "", "unexpected end of input"},
+		{`root ::= "\q"`, "", `unknown escape \q`},
+		{`root ::= ("a"`, "", "expecting ')'"},
+		{`root ::= *`, "", "expecting an item before *"},
+		{`root ::= "a"`, "start", `start rule "start"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseGrammar(tt.src, tt.rule)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseGrammar(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestParseGrammarLeftRecursion(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`root ::= root "a"`, `line 1, column 1: rule "root" is left-recursive`},
+		{"root ::= a\na ::= b a\nb ::= \"x\"?", `line 2, column 1: rule "a" is left-recursive`},
+		{"root ::= (\"x\" | root) \"a\"", `rule "root" is left-recursive`},
+		{"root ::= a\na ::= \"x\"* root", `line 1, column 1: rule "root" is left-recursive`},
+	}
+	for _, tt := range tests {
+		_, err := ParseGrammar(tt.src, "")
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseGrammar(%q) error = %v, want %q", tt.src, err, tt.want)
+		}
+	}
+
+	// Recursion after a character, or after a rule that cannot be empty, is fine.
+	for _, src := range []string{`root ::= "a" root | "b"`, "root ::= a root | a\na ::= \"x\""} {
+		if _, err := ParseGrammar(src, ""); err != nil {
+			t.Errorf("ParseGrammar(%q) = %v", src, err)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package whisper
+
+import "testing"
+
+func TestSortLanguages(t *testing.T) {
+	langs := []LanguageProb{
+		{Code: "en", Probability: 0.2},
+		{Code: "he", Probability: 0.7},
+		{Code: "de", Probability: 0.1},
+	}
+	sortLanguages(langs)
+	for i, want := range []string{"he", "en", "de"} {
+		if langs[i].Code != want {
+			t.Fatalf("langs = %+v, want order he, en, de", langs)
+		}
+	}
+}
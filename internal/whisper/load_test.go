@@ -0,0 +1,26 @@
+package whisper
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadModelFileProgress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.bin")
+	data := bytes.Repeat([]byte{1}, modelReadChunk+10)
+	os.WriteFile(path, data, 0o644)
+
+	var reports []int
+	buf, err := readModelFile(path, func(p int) { reports = append(reports, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Error("content mismatch")
+	}
+	if len(reports) != 2 || reports[0] != 99 || reports[1] != 100 {
+		t.Errorf("progress = %v, want [99 100]", reports)
+	}
+}
@@ -0,0 +1,106 @@
+package whisper
+
+import (
+	"math"
+	"slices"
+)
+
+// Energy VAD tuning. Frames are 30 ms; a frame is speech if its level is
+// well above the recording's noise floor and not near digital silence. In
+// recordings with hardly any pauses the "floor" is speech itself, so the
+// threshold also stays well below the loud frames.
+const (
+	vadFrame        = 30 * SampleRate / 1000
+	vadAboveFloorDB = 12
+	vadBelowLoudDB  = 20
+	vadMinLevelDB   = -50
+	vadMinSpeech    = 250 * SampleRate / 1000 // shorter bursts are dropped
+	vadMinSilence   = 500 * SampleRate / 1000 // shorter pauses are kept
+	vadPad          = 200 * SampleRate / 1000 // kept around each speech span
+)
+
+// span is a range of samples [start, end).
+type span struct{ start, end int }
+
+// energyVAD returns the speech spans of samples, found by frame energy. It
+// is the fallback when no Silero model is given; it copes with silence and
+// steady noise but, unlike Silero, not with music.
+func energyVAD(samples []float32) []span {
+	nFrames := len(samples) / vadFrame
+	if nFrames == 0 {
+		return nil
+	}
+	levels := make([]float64, nFrames)
+	for i := range levels {
+		var sum float64
+		for _, v := range samples[i*vadFrame : (i+1)*vadFrame] {
+			sum += float64(v) * float64(v)
+		}
+		levels[i] = 10 * math.Log10(sum/vadFrame+1e-12)
+	}
+	sorted := slices.Clone(levels)
+	slices.Sort(sorted)
+	floor, loud := sorted[len(sorted)/10], sorted[len(sorted)*9/10]
+	threshold := max(min(floor+vadAboveFloorDB, loud-vadBelowLoudDB), vadMinLevelDB)
+
+	var spans []span
+	for i, level := range levels {
+		if level < threshold {
+			continue
+		}
+		start, end := i*vadFrame, (i+1)*vadFrame
+		if n := len(spans); n > 0 && start-spans[n-1].end < vadMinSilence {
+			spans[n-1].end = end
+		} else {
+			spans = append(spans, span{start, end})
+		}
+	}
+	spans = slices.DeleteFunc(spans, func(s span) bool { return s.end-s.start < vadMinSpeech })
+	return padSpans(spans, vadPad, len(samples))
+}
+
+// padSpans widens spans by pad on both sides, clamped to [0, n), and merges
+// the ones that then overlap.
+func padSpans(spans []span, pad, n int) []span {
+	var out []span
+	for _, s := range spans {
+		s.start, s.end = max(0, s.start-pad), min(n, s.end+pad)
+		if k := len(out); k > 0 && s.start <= out[k-1].end {
+			out[k-1].end = max(out[k-1].end, s.end)
+		} else {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// speechMap maps times in the audio passed to whisper, the speech spans
+// concatenated, back to the original recording.
+type speechMap []span
+
+// keep returns the samples of the spans in m, concatenated.
+func (m speechMap) keep(samples []float32) []float32 {
+	var out []float32
+	for _, s := range m {
+		out = append(out, samples[s.start:s.end]...)
+	}
+	return out
+}
+
+// original maps t, in centiseconds of the concatenated audio, to the
+// original timeline. A time on the seam between two spans maps to the start
+// of the later span, or to the end of the earlier one if isEnd is set.
+func (m speechMap) original(t int64, isEnd bool) int64 {
+	if len(m) == 0 {
+		return t
+	}
+	off := int(t * SampleRate / 100)
+	for i, s := range m {
+		n := s.end - s.start
+		if off < n || (isEnd && off == n) || i == len(m)-1 {
+			return int64(s.start+off) * 100 / SampleRate
+		}
+		off -= n
+	}
+	return t
+}
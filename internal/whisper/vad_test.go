@@ -0,0 +1,116 @@
+package whisper
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+// tone returns seconds of a 440 Hz sine at amplitude amp.
+func tone(seconds float64, amp float32) []float32 {
+	out := make([]float32, int(seconds*SampleRate))
+	for i := range out {
+		out[i] = amp * float32(math.Sin(2*math.Pi*440*float64(i)/SampleRate))
+	}
+	return out
+}
+
+func TestEnergyVAD(t *testing.T) {
+	var samples []float32
+	samples = append(samples, tone(1, 0.001)...) // background hiss
+	samples = append(samples, tone(1, 0.3)...)
+	samples = append(samples, tone(1.5, 0.001)...)
+	samples = append(samples, tone(0.5, 0.3)...)
+	samples = append(samples, tone(0.1, 0.001)...) // pause too short to split
+	samples = append(samples, tone(0.5, 0.3)...)
+	samples = append(samples, tone(1, 0.001)...)
+	samples = append(samples, tone(0.1, 0.3)...) // click, too short for speech
+	samples = append(samples, tone(1, 0.001)...)
+
+	got := energyVAD(samples)
+	want := []span{
+		{SampleRate - vadPad, 2*SampleRate + vadPad},
+		{3.5*SampleRate - vadPad, 4.6*SampleRate + vadPad},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("energyVAD = %v, want %v", got, want)
+	}
+	// Frames are 30 ms, so edges may be off by one frame.
+	for i := range want {
+		if abs(got[i].start-want[i].start) > vadFrame || abs(got[i].end-want[i].end) > vadFrame {
+			t.Fatalf("energyVAD = %v, want %v", got, want)
+		}
+	}
+
+	// Without pauses everything is speech.
+	if got := energyVAD(tone(2, 0.3)); !slices.Equal(got, []span{{0, 2 * SampleRate}}) {
+		t.Errorf("energyVAD(tone) = %v, want the whole input", got)
+	}
+	if got := energyVAD(make([]float32, SampleRate)); len(got) != 0 {
+		t.Errorf("energyVAD(silence) = %v, want no spans", got)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestPadSpans(t *testing.T) {
+	got := padSpans([]span{{10, 20}, {25, 30}, {50, 60}}, 5, 62)
+	want := []span{{5, 35}, {45, 62}}
+	if !slices.Equal(got, want) {
+		t.Errorf("padSpans = %v, want %v", got, want)
+	}
+}
+
+func TestSpeechMap(t *testing.T) {
+	// Speech from 1s to 2s and from 5s to 7s.
+	m := speechMap{{SampleRate, 2 * SampleRate}, {5 * SampleRate, 7 * SampleRate}}
+
+	tests := []struct {
+		t     int64
+		isEnd bool
+		want  int64
+	}{
+		{0, false, 100},
+		{50, false, 150},
+		{100, false, 500}, // seam: start of the second span
+		{100, true, 200},  // seam: end of the first span
+		{250, true, 650},
+		{300, true, 700},
+		{320, true, 720}, // past the end stays on the last span
+	}
+	for _, tt := range tests {
+		if got := m.original(tt.t, tt.isEnd); got != tt.want {
+			t.Errorf("original(%d, %v) = %d, want %d", tt.t, tt.isEnd, got, tt.want)
+		}
+	}
+
+	seg := (Segment{
+		Start:  50,
+		End:    150,
+		Words:  []Word{{Start: 50, End: 100, Text: "a"}, {Start: 100, End: 150, Text: "b"}},
+		Tokens: []Token{{Start: 50, End: 100}, {Start: 100, End: 150}},
+	}).MapTimes(m.original)
+	if seg.Start != 150 || seg.End != 550 {
+		t.Errorf("segment spans %d-%d, want 150-550", seg.Start, seg.End)
+	}
+	if w := seg.Words[1]; w.Start != 500 || w.End != 550 {
+		t.Errorf("second word spans %d-%d, want 500-550", w.Start, w.End)
+	}
+	if tok := seg.Tokens[0]; tok.Start != 150 || tok.End != 200 {
+		t.Errorf("first token spans %d-%d, want 150-200", tok.Start, tok.End)
+	}
+
+	if got := (Segment{Tokens: []Token{{ID: 1}}}).MapTimes(m.original).Tokens[0]; got.Start != 0 {
+		t.Errorf("token times mapped without word timestamps: %+v", got)
+	}
+
+	samples := make([]float32, 8*SampleRate)
+	if got := len(m.keep(samples)); got != 3*SampleRate {
+		t.Errorf("keep returned %d samples, want %d", got, 3*SampleRate)
+	}
+}
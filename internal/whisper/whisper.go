@@ -1,12 +1,19 @@
 package whisper
 
 import (
+	"cmp"
 	"errors"
+	"io"
+	"os"
+	"slices"
 	"strings"
 )
 
 var ErrNotImplemented = errors.New("whisper: not implemented on this platform")
 
+// SampleRate is the sample rate whisper expects, in Hz (mono float32).
+const SampleRate = 16000
+
 // TranscribeOptions controls transcription behavior.
 type TranscribeOptions struct {
 	Language        string  // e.g. "en", "he" (empty = whisper.cpp default: "en")
@@ -17,23 +24,129 @@ type TranscribeOptions struct {
 	Verbose         bool    // enable whisper/ggml logs
 	Temperature     float32 // initial decoding temperature (0 = whisper default)
 	MaxTextCtx      int     // max tokens from past text as context (0 = whisper default)
-	WordTimestamps  bool    // enable token-level timestamps
+	WordTimestamps  bool    // enable token-level timestamps and fill Segment.Words
 	MaxSegmentLen   int     // max segment length in characters (0 = no limit)
 	SamplingGreedy  bool    // use greedy strategy (default); false = beam search
 	BestOf          int     // greedy: number of top candidates (0 = whisper default)
 	BeamSize        int     // beam search: beam width (0 = whisper default)
+	VAD             bool    // transcribe only speech; timestamps still refer to the full audio
+	VADModelPath    string  // Silero ggml model for VAD (empty = built-in energy VAD)
+	Grammar         string  // GBNF grammar constraining the output, see ParseGrammar (empty = none)
+	GrammarRule     string  // start rule of Grammar (empty = "root")
+	GrammarPenalty  float32 // logit penalty for tokens outside Grammar (0 = whisper default)
 }
 
 // Segment represents a transcribed text segment with timestamps.
 type Segment struct {
-	Start int64  // start time in centiseconds (10ms units)
-	End   int64  // end time in centiseconds (10ms units)
-	Text  string
+	Start        int64 // start time in centiseconds (10ms units)
+	End          int64 // end time in centiseconds (10ms units)
+	Text         string
+	Words        []Word  // set only with TranscribeOptions.WordTimestamps
+	Tokens       []Token // text tokens; special and timestamp tokens are left out
+	AvgLogprob   float32 // mean log probability of Tokens
+	NoSpeechProb float32 // probability that the segment has no speech
+}
+
+// MapTimes returns seg with every timestamp t replaced by f(t, isEnd),
+// where isEnd is set for end times. Word and token times are mapped only if
+// the segment has words (see TranscribeOptions.WordTimestamps).
+func (seg Segment) MapTimes(f func(t int64, isEnd bool) int64) Segment {
+	seg.Start, seg.End = f(seg.Start, false), f(seg.End, true)
+	if seg.Words == nil {
+		return seg
+	}
+	seg.Words = slices.Clone(seg.Words)
+	for i := range seg.Words {
+		w := &seg.Words[i]
+		w.Start, w.End = f(w.Start, false), f(w.End, true)
+	}
+	seg.Tokens = slices.Clone(seg.Tokens)
+	for i := range seg.Tokens {
+		t := &seg.Tokens[i]
+		t.Start, t.End = f(t.Start, false), f(t.End, true)
+	}
+	return seg
+}
+
+// Word is a word with timestamps, built from one or more text tokens.
+type Word struct {
+	Start       int64   // start time in centiseconds (10ms units)
+	End         int64   // end time in centiseconds (10ms units)
+	Text        string  // without surrounding whitespace
+	Probability float32 // mean probability of the word's tokens
+}
+
+// Token is a decoded text token.
+type Token struct {
+	ID          int
+	Text        string
+	Start       int64 // start time in centiseconds; set only with WordTimestamps
+	End         int64 // end time in centiseconds; set only with WordTimestamps
+	Probability float32
+	Logprob     float32
+}
+
+// avgLogprob returns the mean log probability of tokens, or 0 without any.
+func avgLogprob(tokens []Token) float32 {
+	if len(tokens) == 0 {
+		return 0
+	}
+	var sum float32
+	for _, t := range tokens {
+		sum += t.Logprob
+	}
+	return sum / float32(len(tokens))
+}
+
+// groupWords merges tokens into words. A token starting with a space begins
+// a new word; any other token continues the current one (word pieces,
+// punctuation, split UTF-8 sequences).
+func groupWords(tokens []Token) []Word {
+	var words []Word
+	var text strings.Builder
+	var cur Word
+	var n int // tokens in cur
+	flush := func() {
+		if n == 0 {
+			return
+		}
+		if cur.Text = strings.TrimSpace(text.String()); cur.Text != "" {
+			cur.Probability /= float32(n)
+			words = append(words, cur)
+		}
+		text.Reset()
+		cur, n = Word{}, 0
+	}
+	for _, t := range tokens {
+		if strings.HasPrefix(t.Text, " ") {
+			flush()
+		}
+		if n == 0 {
+			cur.Start = t.Start
+		}
+		text.WriteString(t.Text)
+		cur.End = t.End
+		cur.Probability += t.Probability
+		n++
+	}
+	flush()
+	return words
 }
 
 // TranscribeResult holds the output of a transcription.
 type TranscribeResult struct {
 	Segments []Segment
+	Language string // code of the spoken (or requested) language, e.g. "en"
+}
+
+// MapTimes returns r with every segment mapped by Segment.MapTimes.
+func (r TranscribeResult) MapTimes(f func(t int64, isEnd bool) int64) TranscribeResult {
+	segments := make([]Segment, len(r.Segments))
+	for i, seg := range r.Segments {
+		segments[i] = seg.MapTimes(f)
+	}
+	r.Segments = segments
+	return r
 }
 
 // Text returns the concatenated text of all segments.
@@ -45,6 +158,22 @@ func (r TranscribeResult) Text() string {
 	return sb.String()
 }
 
+// LanguageDetectWindow is the amount of audio whisper's language detection
+// looks at, its 30 second input window.
+const LanguageDetectWindow = 30 * SampleRate
+
+// LanguageProb is a language with the probability that audio is spoken in it.
+type LanguageProb struct {
+	Code        string // e.g. "en"
+	Name        string // e.g. "english"
+	Probability float32
+}
+
+// sortLanguages orders languages by probability, most likely first.
+func sortLanguages(langs []LanguageProb) {
+	slices.SortStableFunc(langs, func(a, b LanguageProb) int { return cmp.Compare(b.Probability, a.Probability) })
+}
+
 // StreamCallbacks provides real-time feedback during transcription.
 type StreamCallbacks struct {
 	// OnProgress is called with a percentage (0-100) during inference.
@@ -54,3 +183,34 @@ type StreamCallbacks struct {
 	// ShouldAbort is polled during inference; return true to cancel.
 	ShouldAbort func() bool
 }
+
+// modelReadChunk is how much of a model file is read between progress reports.
+const modelReadChunk = 16 << 20
+
+// readModelFile reads a whole model file, reporting the percentage read.
+func readModelFile(path string, onProgress func(progress int)) ([]byte, error) {
+	if onProgress == nil {
+		return os.ReadFile(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, info.Size())
+	for n := 0; n < len(buf); {
+		end := min(n+modelReadChunk, len(buf))
+		read, err := io.ReadFull(f, buf[n:end])
+		n += read
+		if err != nil {
+			return nil, err
+		}
+		onProgress(int(int64(n) * 100 / int64(len(buf))))
+	}
+	return buf, nil
+}
@@ -15,26 +15,22 @@ import (
 //export sonaGoProgressCB
 func sonaGoProgressCB(handle uintptr, progress int32) {
 	h := cgo.Handle(handle)
-	cb := h.Value().(*StreamCallbacks)
+	cb := h.Value().(*callbackState)
 	if cb.OnProgress != nil {
 		cb.OnProgress(int(progress))
 	}
 }
 
 //export sonaGoSegmentCB
-func sonaGoSegmentCB(handle uintptr, ctxPtr unsafe.Pointer, nNew int32) {
+func sonaGoSegmentCB(handle uintptr, ctxPtr, statePtr unsafe.Pointer, nNew int32) {
 	h := cgo.Handle(handle)
-	cb := h.Value().(*StreamCallbacks)
+	cb := h.Value().(*callbackState)
 	if cb.OnSegment != nil {
 		ctx := (*C.struct_whisper_context)(ctxPtr)
-		nSegments := int(C.whisper_full_n_segments(ctx))
+		state := (*C.struct_whisper_state)(statePtr)
+		nSegments := int(C.whisper_full_n_segments_from_state(state))
 		for i := nSegments - int(nNew); i < nSegments; i++ {
-			seg := Segment{
-				Start: int64(C.whisper_full_get_segment_t0(ctx, C.int(i))),
-				End:   int64(C.whisper_full_get_segment_t1(ctx, C.int(i))),
-				Text:  C.GoString(C.whisper_full_get_segment_text(ctx, C.int(i))),
-			}
-			cb.OnSegment(seg)
+			cb.OnSegment(readSegment(ctx, state, i, cb.words))
 		}
 	}
 }
@@ -42,7 +38,7 @@ func sonaGoSegmentCB(handle uintptr, ctxPtr unsafe.Pointer, nNew int32) {
 //export sonaGoAbortCB
 func sonaGoAbortCB(handle uintptr) int32 {
 	h := cgo.Handle(handle)
-	cb := h.Value().(*StreamCallbacks)
+	cb := h.Value().(*callbackState)
 	if cb.ShouldAbort != nil && cb.ShouldAbort() {
 		return 1
 	}
@@ -11,13 +11,24 @@ import "C"
 
 import (
 	"fmt"
-	"os"
+	"runtime"
 	"runtime/cgo"
 	"unsafe"
 )
 
+// Context is a loaded model. Its methods run on a default whisper state, so
+// only one may run at a time; use NewState for concurrent transcriptions.
 type Context struct {
-	ctx *C.struct_whisper_context
+	ctx   *C.struct_whisper_context
+	state *State // default state
+}
+
+// State holds the buffers of one inference run and shares the model weights
+// of its Context. Different states of a Context can be used concurrently,
+// but each state by one goroutine at a time.
+type State struct {
+	ctx   *C.struct_whisper_context
+	state *C.struct_whisper_state
 }
 
 func SetVerbose(v bool) {
@@ -29,13 +40,23 @@ func SetVerbose(v bool) {
 }
 
 func New(modelPath string, gpuDevice int, noGpu bool) (*Context, error) {
-	// Read model via Go's os.ReadFile which handles non-ASCII paths on Windows
+	return NewWithProgress(modelPath, gpuDevice, noGpu, nil)
+}
+
+// NewWithProgress is like New and calls onProgress with the percentage
+// (0-100) of the model file read so far. Initialization after the file is
+// read is not reported.
+func NewWithProgress(modelPath string, gpuDevice int, noGpu bool, onProgress func(progress int)) (*Context, error) {
+	// Read model via Go's os file API which handles non-ASCII paths on Windows
 	// (Go uses CreateFileW internally), then pass the buffer to whisper.cpp
 	// to avoid fopen() failing on non-ASCII paths with MinGW's C runtime.
-	buf, err := os.ReadFile(modelPath)
+	buf, err := readModelFile(modelPath, onProgress)
 	if err != nil {
 		return nil, fmt.Errorf("whisper: failed to read model file %s: %w", modelPath, err)
 	}
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("whisper: model file %s is empty", modelPath)
+	}
 
 	params := C.whisper_context_default_params()
 	if noGpu || !VulkanAvailable() {
@@ -43,11 +64,29 @@ func New(modelPath string, gpuDevice int, noGpu bool) (*Context, error) {
 	} else if gpuDevice >= 0 {
 		params.gpu_device = C.int(gpuDevice)
 	}
-	ctx := C.whisper_init_from_buffer_with_params(unsafe.Pointer(&buf[0]), C.size_t(len(buf)), params)
+	ctx := C.whisper_init_from_buffer_with_params_no_state(unsafe.Pointer(&buf[0]), C.size_t(len(buf)), params)
 	if ctx == nil {
 		return nil, fmt.Errorf("whisper: failed to load model from %s", modelPath)
 	}
-	return &Context{ctx: ctx}, nil
+	c := &Context{ctx: ctx}
+	if c.state, err = c.NewState(); err != nil {
+		C.whisper_free(ctx)
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewState allocates an additional whisper state for c. It must be closed
+// before c.
+func (c *Context) NewState() (*State, error) {
+	if c.ctx == nil {
+		return nil, fmt.Errorf("whisper: context is nil")
+	}
+	state := C.whisper_init_state(c.ctx)
+	if state == nil {
+		return nil, fmt.Errorf("whisper: failed to allocate state")
+	}
+	return &State{ctx: c.ctx, state: state}, nil
 }
 
 // Transcribe runs inference and returns all segments with timestamps.
@@ -55,11 +94,51 @@ func (c *Context) Transcribe(samples []float32, opts TranscribeOptions) (Transcr
 	return c.TranscribeStream(samples, opts, StreamCallbacks{})
 }
 
-// TranscribeStream runs inference with real-time callbacks for progress, segments, and cancellation.
+// TranscribeStream runs inference on the default state with real-time
+// callbacks for progress, segments, and cancellation.
 func (c *Context) TranscribeStream(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
 	if c.ctx == nil {
 		return TranscribeResult{}, fmt.Errorf("whisper: context is nil")
 	}
+	return c.state.TranscribeStream(samples, opts, cb)
+}
+
+// DetectLanguage runs language detection on the default state, see
+// State.DetectLanguage.
+func (c *Context) DetectLanguage(samples []float32, threads int) ([]LanguageProb, error) {
+	if c.ctx == nil {
+		return nil, fmt.Errorf("whisper: context is nil")
+	}
+	return c.state.DetectLanguage(samples, threads)
+}
+
+// TranscribeStream runs inference with real-time callbacks for progress,
+// segments, and cancellation.
+func (s *State) TranscribeStream(samples []float32, opts TranscribeOptions, cb StreamCallbacks) (TranscribeResult, error) {
+	if s.state == nil {
+		return TranscribeResult{}, fmt.Errorf("whisper: state is closed")
+	}
+
+	// With VAD, whisper only sees the speech spans, concatenated; speech
+	// maps its timestamps back.
+	var speech speechMap
+	if opts.VAD && len(samples) > 0 {
+		spans, err := speechSpans(samples, opts)
+		if err != nil {
+			return TranscribeResult{}, err
+		}
+		if len(spans) == 0 {
+			if cb.OnProgress != nil {
+				cb.OnProgress(100)
+			}
+			return TranscribeResult{}, nil
+		}
+		speech = spans
+		samples = speech.keep(samples)
+		if onSegment := cb.OnSegment; onSegment != nil {
+			cb.OnSegment = func(seg Segment) { onSegment(seg.MapTimes(speech.original)) }
+		}
+	}
 
 	strategy := C.enum_whisper_sampling_strategy(C.WHISPER_SAMPLING_GREEDY)
 	if !opts.SamplingGreedy && opts.BeamSize > 0 {
@@ -108,36 +187,215 @@ func (c *Context) TranscribeStream(samples []float32, opts TranscribeOptions, cb
 	if opts.BeamSize > 0 {
 		params.beam_search.beam_size = C.int(opts.BeamSize)
 	}
+	if opts.Grammar != "" {
+		g, err := ParseGrammar(opts.Grammar, opts.GrammarRule)
+		if err != nil {
+			return TranscribeResult{}, err
+		}
+		rules, free := cGrammarRules(g)
+		defer free()
+		params.grammar_rules = rules
+		params.n_grammar_rules = C.size_t(len(g.rules))
+		params.i_start_rule = C.size_t(g.start)
+		if opts.GrammarPenalty > 0 {
+			params.grammar_penalty = C.float(opts.GrammarPenalty)
+		}
+	}
 
 	// Set up streaming callbacks if any are provided.
 	hasCallbacks := cb.OnProgress != nil || cb.OnSegment != nil || cb.ShouldAbort != nil
 	var handle cgo.Handle
 	if hasCallbacks {
-		handle = cgo.NewHandle(&cb)
+		handle = cgo.NewHandle(&callbackState{StreamCallbacks: cb, words: opts.WordTimestamps})
 		defer handle.Delete()
 		C.sona_whisper_set_stream_callbacks(&params, C.uintptr_t(handle))
 	}
 
-	ret := C.whisper_full(c.ctx, params, (*C.float)(&samples[0]), C.int(len(samples)))
+	ret := C.whisper_full_with_state(s.ctx, s.state, params, (*C.float)(&samples[0]), C.int(len(samples)))
 	if ret != 0 {
 		return TranscribeResult{}, fmt.Errorf("whisper: transcription failed with code %d", ret)
 	}
 
 	// Collect all segments with timestamps.
-	nSegments := int(C.whisper_full_n_segments(c.ctx))
+	nSegments := int(C.whisper_full_n_segments_from_state(s.state))
 	segments := make([]Segment, nSegments)
 	for i := 0; i < nSegments; i++ {
-		segments[i] = Segment{
-			Start: int64(C.whisper_full_get_segment_t0(c.ctx, C.int(i))),
-			End:   int64(C.whisper_full_get_segment_t1(c.ctx, C.int(i))),
-			Text:  C.GoString(C.whisper_full_get_segment_text(c.ctx, C.int(i))),
+		segments[i] = readSegment(s.ctx, s.state, i, opts.WordTimestamps)
+		if speech != nil {
+			segments[i] = segments[i].MapTimes(speech.original)
 		}
 	}
 
-	return TranscribeResult{Segments: segments}, nil
+	result := TranscribeResult{Segments: segments}
+	if id := C.whisper_full_lang_id_from_state(s.state); id >= 0 {
+		result.Language = C.GoString(C.whisper_lang_str(id))
+	}
+	return result, nil
+}
+
+// cGrammarRules copies the rules of g to C memory for whisper_full_params.
+// The returned function frees it.
+func cGrammarRules(g *Grammar) (**C.whisper_grammar_element, func()) {
+	ptrs := (**C.whisper_grammar_element)(C.malloc(C.size_t(len(g.rules)) * C.size_t(unsafe.Sizeof(uintptr(0)))))
+	rules := unsafe.Slice(ptrs, len(g.rules))
+	for i, rule := range g.rules {
+		mem := (*C.whisper_grammar_element)(C.malloc(C.size_t(len(rule)) * C.size_t(unsafe.Sizeof(C.whisper_grammar_element{}))))
+		elems := unsafe.Slice(mem, len(rule))
+		for j, el := range rule {
+			elems[j]._type = C.enum_whisper_gretype(el.typ)
+			elems[j].value = C.uint32_t(el.value)
+		}
+		rules[i] = mem
+	}
+	return ptrs, func() {
+		for _, r := range rules {
+			C.free(unsafe.Pointer(r))
+		}
+		C.free(unsafe.Pointer(ptrs))
+	}
 }
 
+// speechSpans finds the speech in samples with whisper.cpp's Silero VAD if
+// opts.VADModelPath is set, else with energyVAD.
+func speechSpans(samples []float32, opts TranscribeOptions) ([]span, error) {
+	if opts.VADModelPath == "" {
+		return energyVAD(samples), nil
+	}
+	cPath := C.CString(opts.VADModelPath)
+	defer C.free(unsafe.Pointer(cPath))
+	ctxParams := C.whisper_vad_default_context_params()
+	if opts.Threads > 0 {
+		ctxParams.n_threads = C.int(opts.Threads)
+	}
+	// The Silero model is under 1 MB, so it is simply loaded per call.
+	vctx := C.whisper_vad_init_from_file_with_params(cPath, ctxParams)
+	if vctx == nil {
+		return nil, fmt.Errorf("whisper: failed to load VAD model from %s", opts.VADModelPath)
+	}
+	defer C.whisper_vad_free(vctx)
+
+	segs := C.whisper_vad_segments_from_samples(vctx, C.whisper_vad_default_params(), (*C.float)(&samples[0]), C.int(len(samples)))
+	if segs == nil {
+		return nil, fmt.Errorf("whisper: voice activity detection failed")
+	}
+	defer C.whisper_vad_free_segments(segs)
+
+	n := int(C.whisper_vad_segments_n_segments(segs))
+	spans := make([]span, 0, n)
+	for i := 0; i < n; i++ {
+		// Segment times are in centiseconds.
+		t0 := float64(C.whisper_vad_segments_get_segment_t0(segs, C.int(i)))
+		t1 := float64(C.whisper_vad_segments_get_segment_t1(segs, C.int(i)))
+		start := max(0, int(t0*SampleRate/100))
+		end := min(len(samples), int(t1*SampleRate/100))
+		if end > start {
+			spans = append(spans, span{start, end})
+		}
+	}
+	// Silero's speech padding can make neighbours overlap.
+	return padSpans(spans, 0, len(samples)), nil
+}
+
+// callbackState is the value behind the cgo handle passed to the callback
+// trampolines.
+type callbackState struct {
+	StreamCallbacks
+	words bool // fill Segment.Words
+}
+
+// readSegment reads segment i of the last whisper_full run on state.
+func readSegment(ctx *C.struct_whisper_context, state *C.struct_whisper_state, i int, words bool) Segment {
+	seg := Segment{
+		Start:        int64(C.whisper_full_get_segment_t0_from_state(state, C.int(i))),
+		End:          int64(C.whisper_full_get_segment_t1_from_state(state, C.int(i))),
+		Text:         C.GoString(C.whisper_full_get_segment_text_from_state(state, C.int(i))),
+		NoSpeechProb: float32(C.whisper_full_get_segment_no_speech_prob_from_state(state, C.int(i))),
+	}
+
+	eot := C.whisper_token_eot(ctx)
+	nTokens := int(C.whisper_full_n_tokens_from_state(state, C.int(i)))
+	seg.Tokens = make([]Token, 0, nTokens)
+	for j := 0; j < nTokens; j++ {
+		data := C.whisper_full_get_token_data_from_state(state, C.int(i), C.int(j))
+		if data.id >= eot {
+			continue // special and timestamp tokens
+		}
+		t := Token{
+			ID:          int(data.id),
+			Text:        C.GoString(C.whisper_full_get_token_text_from_state(ctx, state, C.int(i), C.int(j))),
+			Probability: float32(data.p),
+			Logprob:     float32(data.plog),
+		}
+		if words {
+			t.Start, t.End = int64(data.t0), int64(data.t1)
+		}
+		seg.Tokens = append(seg.Tokens, t)
+	}
+	seg.AvgLogprob = avgLogprob(seg.Tokens)
+	if words {
+		seg.Words = groupWords(seg.Tokens)
+	}
+	return seg
+}
+
+// LanguageID returns whisper's ID for a language code or name ("de",
+// "german"), or -1 if the language is not supported.
+func LanguageID(lang string) int {
+	cLang := C.CString(lang)
+	defer C.free(unsafe.Pointer(cLang))
+	return int(C.whisper_lang_id(cLang))
+}
+
+// DetectLanguage runs whisper's language detection on the first
+// LanguageDetectWindow samples without transcribing them. It returns every
+// supported language, most likely first. threads <= 0 uses the default.
+func (s *State) DetectLanguage(samples []float32, threads int) ([]LanguageProb, error) {
+	if s.state == nil {
+		return nil, fmt.Errorf("whisper: state is closed")
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("whisper: no audio")
+	}
+	samples = samples[:min(len(samples), LanguageDetectWindow)]
+	if threads <= 0 {
+		threads = min(4, runtime.NumCPU()) // same default as whisper_full_default_params
+	}
+
+	if ret := C.whisper_pcm_to_mel_with_state(s.ctx, s.state, (*C.float)(&samples[0]), C.int(len(samples)), C.int(threads)); ret != 0 {
+		return nil, fmt.Errorf("whisper: failed to compute mel spectrogram (code %d)", ret)
+	}
+	probs := make([]float32, int(C.whisper_lang_max_id())+1)
+	if ret := C.whisper_lang_auto_detect_with_state(s.ctx, s.state, 0, C.int(threads), (*C.float)(&probs[0])); ret < 0 {
+		return nil, fmt.Errorf("whisper: language detection failed with code %d", ret)
+	}
+
+	langs := make([]LanguageProb, len(probs))
+	for id, p := range probs {
+		langs[id] = LanguageProb{
+			Code:        C.GoString(C.whisper_lang_str(C.int(id))),
+			Name:        C.GoString(C.whisper_lang_str_full(C.int(id))),
+			Probability: p,
+		}
+	}
+	sortLanguages(langs)
+	return langs, nil
+}
+
+// Close frees the state.
+func (s *State) Close() {
+	if s.state != nil {
+		C.whisper_free_state(s.state)
+		s.state = nil
+	}
+}
+
+// Close frees the model and its default state. States from NewState must
+// be closed first.
 func (c *Context) Close() {
+	if c.state != nil {
+		c.state.Close()
+		c.state = nil
+	}
 	if c.ctx != nil {
 		C.whisper_free(c.ctx)
 		c.ctx = nil
@@ -0,0 +1,33 @@
+package whisper
+
+import "testing"
+
+func TestGroupWords(t *testing.T) {
+	tokens := []Token{
+		{Text: " Hel", Start: 0, End: 20, Probability: 0.8},
+		{Text: "lo", Start: 20, End: 40, Probability: 0.6},
+		{Text: ",", Start: 40, End: 42, Probability: 1},
+		{Text: " world", Start: 50, End: 90, Probability: 0.5},
+		{Text: " ", Start: 90, End: 91, Probability: 0.1},
+	}
+	words := groupWords(tokens)
+	if len(words) != 2 {
+		t.Fatalf("got %d words, want 2: %+v", len(words), words)
+	}
+	if w := words[0]; w.Text != "Hello," || w.Start != 0 || w.End != 42 || w.Probability != 0.8 {
+		t.Errorf("words[0] = %+v", w)
+	}
+	if w := words[1]; w.Text != "world" || w.Start != 50 || w.End != 90 {
+		t.Errorf("words[1] = %+v", w)
+	}
+}
+
+func TestAvgLogprob(t *testing.T) {
+	if got := avgLogprob(nil); got != 0 {
+		t.Errorf("avgLogprob(nil) = %v, want 0", got)
+	}
+	tokens := []Token{{Logprob: -0.5}, {Logprob: -1.5}}
+	if got := avgLogprob(tokens); got != -1 {
+		t.Errorf("avgLogprob = %v, want -1", got)
+	}
+}
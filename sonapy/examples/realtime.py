@@ -0,0 +1,73 @@
+# /// script
+# requires-python = ">=3.12"
+# dependencies = ["sonapy", "websockets"]
+#
+# [tool.uv.sources]
+# sonapy = { path = "../" }
+# ///
+"""
+Realtime transcription — stream a WAV file over a WebSocket at real-time pace.
+
+Setup:
+  wget https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-tiny.bin
+  wget https://github.com/ggml-org/whisper.cpp/raw/refs/heads/master/samples/jfk.wav
+
+Run:
+  uv run examples/realtime.py ggml-tiny.bin jfk.wav
+
+The WAV must be 16kHz mono 16-bit PCM (like jfk.wav).
+"""
+
+import asyncio
+import json
+import sys
+import wave
+
+import websockets
+from sonapy import Sona
+
+CHUNK_SECONDS = 0.1
+
+
+async def stream(url: str, audio_path: str):
+    async with websockets.connect(url) as ws:
+
+        async def send_audio():
+            with wave.open(audio_path, "rb") as wav:
+                frames = int(wav.getframerate() * CHUNK_SECONDS)
+                while chunk := wav.readframes(frames):
+                    await ws.send(chunk)
+                    await asyncio.sleep(CHUNK_SECONDS)
+            await ws.send(json.dumps({"type": "stop"}))
+
+        sender = asyncio.create_task(send_audio())
+        async for message in ws:
+            event = json.loads(message)
+            match event["type"]:
+                case "partial":
+                    print(f"  ... {event['text']}")
+                case "final":
+                    print(f"  [{event['start']:.1f}s] {event['text']}")
+                case "error":
+                    print(f"  error: {event['message']}")
+                case "done":
+                    break
+        await sender
+
+
+def main():
+    if len(sys.argv) < 3:
+        print(f"Usage: {sys.argv[0]} <model.bin> <audio.wav>")
+        sys.exit(1)
+
+    model_path = sys.argv[1]
+    audio_path = sys.argv[2]
+
+    with Sona() as sona:
+        sona.load_model(model_path)
+        url = f"ws://localhost:{sona.port}/v1/audio/realtime"
+        asyncio.run(stream(url, audio_path))
+
+
+if __name__ == "__main__":
+    main()
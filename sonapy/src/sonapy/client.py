@@ -10,8 +10,9 @@ import httpx
 class Client:
     """HTTP client for the Sona API."""
 
-    def __init__(self, base_url: str) -> None:
-        self._http = httpx.Client(base_url=base_url, timeout=None)
+    def __init__(self, base_url: str, api_key: str | None = None) -> None:
+        headers = {"Authorization": f"Bearer {api_key}"} if api_key else None
+        self._http = httpx.Client(base_url=base_url, headers=headers, timeout=None)
 
     def close(self) -> None:
         self._http.close()
@@ -63,6 +64,7 @@ class Client:
             data["language"] = language
         if stream:
             data["stream"] = "true"
+            data["stream_format"] = "ndjson"
         if diarize_model:
             data["diarize_model"] = diarize_model
 
@@ -80,6 +82,24 @@ class Client:
             return r.text
         return r.json()
 
+    def detect_language(self, file_path: str | Path, *, top_k: int = 5) -> dict:
+        """Identify the spoken language without transcribing.
+
+        Returns ``language``, ``probability`` and the *top_k* most likely
+        ``languages``.
+        """
+        path = Path(file_path)
+        if not path.exists():
+            raise FileNotFoundError(f"audio file not found: {path}")
+
+        with open(path, "rb") as f:
+            r = self._http.post(
+                "/v1/audio/language",
+                files={"file": (path.name, f, "application/octet-stream")},
+                data={"top_k": str(top_k)},
+            )
+        return r.json()
+
     def _stream_transcribe(self, path: Path, data: dict) -> Generator[dict, None, None]:
         with open(path, "rb") as f:
             with self._http.stream(
@@ -41,7 +41,7 @@ def _find_binary() -> str | None:
 class Runner:
     """Manages the ``sona`` child process lifecycle."""
 
-    def __init__(self, port: int = 0) -> None:
+    def __init__(self, port: int = 0, api_key: str | None = None) -> None:
         binary = _find_binary()
         if binary is None:
             raise SonaError(
@@ -49,10 +49,18 @@ class Runner:
                 "in your virtualenv bin/, or on PATH."
             )
 
+        env = None
+        if api_key:
+            # Passed via the environment so the key does not show up in ps.
+            env = {**os.environ, "SONA_API_KEY": api_key}
+
         self._process = subprocess.Popen(
-            [binary, "serve", "--port", str(port)],
+            # --parent-pid lets sona shut itself down if this process dies
+            # without calling stop().
+            [binary, "serve", "--port", str(port), "--parent-pid", str(os.getpid())],
             stdout=subprocess.PIPE,
             stderr=subprocess.PIPE,
+            env=env,
         )
 
         try:
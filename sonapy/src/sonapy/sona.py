@@ -18,11 +18,11 @@ class Sona:
             print(sona.transcribe("audio.wav"))
     """
 
-    def __init__(self, port: int = 0) -> None:
-        self._runner = Runner(port=port)
+    def __init__(self, port: int = 0, api_key: str | None = None) -> None:
+        self._runner = Runner(port=port, api_key=api_key)
         self.port: int = self._runner.port
         self.base_url: str = f"http://localhost:{self.port}"
-        self._client = Client(base_url=self.base_url)
+        self._client = Client(base_url=self.base_url, api_key=api_key)
         atexit.register(self.stop)
 
     def __enter__(self) -> Sona:
@@ -75,3 +75,6 @@ class Sona:
             stream=stream,
             diarize_model=diarize_model,
         )
+
+    def detect_language(self, file_path: str | Path, *, top_k: int = 5) -> dict:
+        return self._client.detect_language(file_path, top_k=top_k)
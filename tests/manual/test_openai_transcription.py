@@ -64,6 +64,22 @@ def main() -> None:
     print("transcription response:")
     print(result)
 
+    with audio_path.open("rb") as f:
+        stream = client.audio.transcriptions.create(
+            model=args.model,
+            file=f,
+            stream=True,
+        )
+        print("streaming events:")
+        for event in stream:
+            print(event)
+
+    with audio_path.open("rb") as f:
+        translation = client.audio.translations.create(model=args.model, file=f)
+
+    print("translation response:")
+    print(translation)
+
 
 if __name__ == "__main__":
     main()